@@ -2,7 +2,19 @@ package skillserver
 
 import (
 	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
 )
 
 /**
@@ -10,84 +22,2342 @@ import (
  * https://developer.amazon.com/public/solutions/alexa/alexa-skills-kit/docs/speech-synthesis-markup-language-ssml-reference
  */
 
+// Named prosody levels understood by AppendProsody.
+const (
+	RateXSlow  = "x-slow"
+	RateSlow   = "slow"
+	RateMedium = "medium"
+	RateFast   = "fast"
+	RateXFast  = "x-fast"
+
+	PitchXLow   = "x-low"
+	PitchLow    = "low"
+	PitchMedium = "medium"
+	PitchHigh   = "high"
+	PitchXHigh  = "x-high"
+
+	VolumeSilent = "silent"
+	VolumeXSoft  = "x-soft"
+	VolumeSoft   = "soft"
+	VolumeMedium = "medium"
+	VolumeLoud   = "loud"
+	VolumeXLoud  = "x-loud"
+)
+
+// Break strengths understood by AppendBreak.
+const (
+	BreakNone    = "none"
+	BreakXWeak   = "x-weak"
+	BreakWeak    = "weak"
+	BreakMedium  = "medium"
+	BreakStrong  = "strong"
+	BreakXStrong = "x-strong"
+)
+
+// Emphasis levels understood by AppendEmphasis.
+const (
+	EmphasisStrong   = "strong"
+	EmphasisModerate = "moderate"
+	EmphasisReduced  = "reduced"
+	EmphasisNone     = "none"
+)
+
+// Say-as interpretations understood by AppendSayAs. Any other value Alexa
+// supports can be passed as a plain string.
+const (
+	SayAsCharacters   = "characters"
+	SayAsSpellOut     = "spell-out"
+	SayAsCardinal     = "cardinal"
+	SayAsOrdinal      = "ordinal"
+	SayAsInterjection = "interjection"
+	SayAsTelephone    = "telephone"
+	SayAsUnit         = "unit"
+	SayAsFraction     = "fraction"
+	SayAsDigits       = "digits"
+	SayAsAddress      = "address"
+	SayAsExpletive    = "expletive"
+	SayAsTime         = "time"
+)
+
+// Date formats understood by AppendSayAsDate. Any other value Alexa supports
+// can be passed as a plain string.
+const (
+	DateFormatMDY = "mdy"
+	DateFormatDMY = "dmy"
+	DateFormatYMD = "ymd"
+	DateFormatMD  = "md"
+	DateFormatDM  = "dm"
+	DateFormatYM  = "ym"
+	DateFormatMY  = "my"
+	DateFormatD   = "d"
+	DateFormatM   = "m"
+	DateFormatY   = "y"
+)
+
+// Phonetic alphabets understood by AppendPhoneme.
+const (
+	PhonemeIPA    = "ipa"
+	PhonemeXSampa = "x-sampa"
+)
+
+// Effects understood by AppendAmazonEffect.
+const (
+	EffectWhispered = "whispered"
+	// EffectDRC applies dynamic range compression so quiet parts are easier
+	// to hear in noisy environments.
+	EffectDRC = "drc"
+)
+
+// Phonations understood by AppendPhonation.
+const (
+	PhonationSoft = "soft"
+)
+
+// Speaking styles understood by AppendDomain. Any other domain Alexa supports
+// can be passed as a plain string.
+const (
+	DomainNews           = "news"
+	DomainMusic          = "music"
+	DomainConversational = "conversational"
+	DomainLongForm       = "long-form"
+)
+
+// Emotions and intensities understood by AppendEmotion.
+const (
+	EmotionExcited      = "excited"
+	EmotionDisappointed = "disappointed"
+
+	EmotionIntensityLow    = "low"
+	EmotionIntensityMedium = "medium"
+	EmotionIntensityHigh   = "high"
+)
+
+// Word roles understood by AppendWord to pick the meaning of a homograph.
+const (
+	WordRoleVerbPresent     = "amazon:VB"
+	WordRoleVerbPast        = "amazon:VBD"
+	WordRoleNoun            = "amazon:NN"
+	WordRoleSenseNonDefault = "amazon:SENSE_1"
+)
+
+// Amazon Polly voices that can be used with AppendVoice. Any other voice name
+// can be passed as a plain string.
+const (
+	VoiceIvy      = "Ivy"
+	VoiceJoanna   = "Joanna"
+	VoiceJoey     = "Joey"
+	VoiceJustin   = "Justin"
+	VoiceKendra   = "Kendra"
+	VoiceKimberly = "Kimberly"
+	VoiceMatthew  = "Matthew"
+	VoiceSalli    = "Salli"
+	VoiceNicole   = "Nicole"
+	VoiceRussell  = "Russell"
+	VoiceAmy      = "Amy"
+	VoiceBrian    = "Brian"
+	VoiceEmma     = "Emma"
+	VoiceAditi    = "Aditi"
+	VoiceRaveena  = "Raveena"
+	VoiceHans     = "Hans"
+	VoiceMarlene  = "Marlene"
+	VoiceVicki    = "Vicki"
+	VoiceConchita = "Conchita"
+	VoiceEnrique  = "Enrique"
+	VoiceLucia    = "Lucia"
+	VoiceMia      = "Mia"
+	VoiceMiguel   = "Miguel"
+	VoicePenelope = "Penelope"
+	VoiceLupe     = "Lupe"
+	VoiceCeline   = "Celine"
+	VoiceLea      = "Lea"
+	VoiceMathieu  = "Mathieu"
+	VoiceChantal  = "Chantal"
+	VoiceCarla    = "Carla"
+	VoiceGiorgio  = "Giorgio"
+	VoiceBianca   = "Bianca"
+	VoiceMizuki   = "Mizuki"
+	VoiceTakumi   = "Takumi"
+	VoiceRicardo  = "Ricardo"
+	VoiceVitoria  = "Vitoria"
+	VoiceCamila   = "Camila"
+)
+
+// MaxOutputLength is the largest number of characters Alexa accepts in the
+// SSML of a single output speech.
+const MaxOutputLength = 8000
+
+// DefaultWordsPerMinute is the speaking rate EstimateDuration assumes unless
+// WithWPM or SetWordsPerMinute is used.
+const DefaultWordsPerMinute = 150
+
+// MaxAudioCount is the largest number of audio elements Alexa accepts in a
+// single response.
+const MaxAudioCount = 5
+
+// maxBreakDuration is the longest pause Alexa accepts in a break element.
+const maxBreakDuration = 10 * time.Second
+
+// validateBreakDuration returns an error if d is negative or longer than
+// maxBreakDuration. Zero is left to the caller, since AppendBreak takes it to
+// mean no time attribute.
+func validateBreakDuration(d time.Duration) error {
+	if d < 0 {
+		return errors.New("Break duration must not be negative.")
+	}
+
+	if d > maxBreakDuration {
+		return fmt.Errorf("Break duration %s exceeds the %s maximum.", d, maxBreakDuration)
+	}
+
+	return nil
+}
+
+// Ranges Alexa supports for relative prosody pitch (in percent) and volume (in
+// decibels).
+const (
+	minProsodyPitch  = -33.3
+	maxProsodyPitch  = 50.0
+	minProsodyVolume = -6.0
+	maxProsodyVolume = 4.08
+)
+
+// Range of prosody pitch in semitones, which is the percent range above
+// rounded to whole semitones.
+const (
+	minProsodySemitones = -7
+	maxProsodySemitones = 7
+)
+
+// maxRepeatCount is the largest repeatCount an audio element may have.
+const maxRepeatCount = 10
+
+// Range of the soundLevel of an audio element, in decibels.
+const (
+	minSoundLevel = -6
+	maxSoundLevel = 6
+)
+
+// Range Alexa supports for the vocal tract length, in percent.
+const (
+	minVocalTractLength = 50
+	maxVocalTractLength = 200
+)
+
+// langLocales holds the locales Alexa accepts in the lang element.
+var langLocales = map[string]bool{
+	"de-DE": true,
+	"en-AU": true,
+	"en-CA": true,
+	"en-GB": true,
+	"en-IN": true,
+	"en-US": true,
+	"es-ES": true,
+	"es-MX": true,
+	"es-US": true,
+	"fr-CA": true,
+	"fr-FR": true,
+	"hi-IN": true,
+	"it-IT": true,
+	"ja-JP": true,
+	"pt-BR": true,
+}
+
+// supportedTags holds the SSML elements Alexa accepts.
+var supportedTags = map[string]bool{
+	"amazon:domain":  true,
+	"amazon:effect":  true,
+	"amazon:emotion": true,
+	"audio":          true,
+	"break":          true,
+	"emphasis":       true,
+	"lang":           true,
+	"mark":           true,
+	"p":              true,
+	"phoneme":        true,
+	"prosody":        true,
+	"s":              true,
+	"say-as":         true,
+	"speak":          true,
+	"sub":            true,
+	"voice":          true,
+	"w":              true,
+}
+
+// disallowedParents maps an element to the elements Alexa does not allow it
+// to be nested in, at any depth.
+var disallowedParents = map[string][]string{
+	"audio": {"audio"},
+	"p":     {"p", "s"},
+	"s":     {"s"},
+	"speak": {"speak"},
+}
+
+// speakDocument matches a whole speak document and captures its xml:lang and
+// its content.
+var speakDocument = regexp.MustCompile(`(?s)^<speak(?: xml:lang="([^"]*)")?>(.*)</speak>$`)
+
+// startTag matches the start of an element and captures its name.
+var startTag = regexp.MustCompile(`<([A-Za-z][\w:.-]*)`)
+
+// breakTime matches the time of a break element and captures its value and
+// unit, ms or s.
+var breakTime = regexp.MustCompile(`<break[^>]* time="(\d+(?:\.\d+)?)(ms|s)"`)
+
+// markName matches the names accepted by AppendMark.
+var markName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// subElement matches a sub element and captures its alias.
+var subElement = regexp.MustCompile(`<sub alias="([^"]*)">[^<]*</sub>`)
+
+// speechcons holds the speechcons registered per locale, in lower case,
+// guarded by speechconsMu.
+var (
+	speechcons   = map[string]map[string]bool{}
+	speechconsMu sync.RWMutex
+)
+
+// RegisterSpeechcons records the speechcons available in locale, as listed in
+// Amazon's speechcon reference. No lists ship with this package, so
+// AppendInterjection accepts any text until a list is registered. Once a
+// locale has speechcons registered, builders created WithLocale(locale) reject
+// any other interjection. It is safe to call concurrently with building.
+func RegisterSpeechcons(locale string, names ...string) {
+	speechconsMu.Lock()
+	defer speechconsMu.Unlock()
+
+	if speechcons[locale] == nil {
+		speechcons[locale] = map[string]bool{}
+	}
+
+	for _, name := range names {
+		speechcons[locale][strings.ToLower(name)] = true
+	}
+}
+
+// isSpeechcon reports whether text may be used as a speechcon in locale, which
+// is always the case if no speechcons have been registered for it.
+func isSpeechcon(locale, text string) bool {
+	speechconsMu.RLock()
+	defer speechconsMu.RUnlock()
+
+	known, ok := speechcons[locale]
+
+	return !ok || known[strings.ToLower(text)]
+}
+
+// voices holds the voice names of the Voice* constants.
+var voices = map[string]bool{
+	VoiceIvy:      true,
+	VoiceJoanna:   true,
+	VoiceJoey:     true,
+	VoiceJustin:   true,
+	VoiceKendra:   true,
+	VoiceKimberly: true,
+	VoiceMatthew:  true,
+	VoiceSalli:    true,
+	VoiceNicole:   true,
+	VoiceRussell:  true,
+	VoiceAmy:      true,
+	VoiceBrian:    true,
+	VoiceEmma:     true,
+	VoiceAditi:    true,
+	VoiceRaveena:  true,
+	VoiceHans:     true,
+	VoiceMarlene:  true,
+	VoiceVicki:    true,
+	VoiceConchita: true,
+	VoiceEnrique:  true,
+	VoiceLucia:    true,
+	VoiceMia:      true,
+	VoiceMiguel:   true,
+	VoicePenelope: true,
+	VoiceLupe:     true,
+	VoiceCeline:   true,
+	VoiceLea:      true,
+	VoiceMathieu:  true,
+	VoiceChantal:  true,
+	VoiceCarla:    true,
+	VoiceGiorgio:  true,
+	VoiceBianca:   true,
+	VoiceMizuki:   true,
+	VoiceTakumi:   true,
+	VoiceRicardo:  true,
+	VoiceVitoria:  true,
+	VoiceCamila:   true,
+}
+
+// xmlEscaper escapes the characters that are not allowed verbatim in SSML
+// text or double-quoted attribute values.
+var xmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"\"", "&quot;",
+)
+
+// xmlUnescaper reverses xmlEscaper.
+var xmlUnescaper = strings.NewReplacer(
+	"&amp;", "&",
+	"&lt;", "<",
+	"&gt;", ">",
+	"&quot;", "\"",
+)
+
+// stripTags removes all markup from ssml and unescapes the remaining text.
+// Element boundaries separate words, except before punctuation, and runs of
+// whitespace are collapsed to a single space.
+func stripTags(ssml string) string {
+	var text bytes.Buffer
+	inTag, boundary := false, false
+
+	for _, r := range ssml {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag, boundary = false, true
+		case !inTag:
+			if boundary && text.Len() > 0 && !strings.ContainsRune(".,;:!?", r) {
+				text.WriteByte(' ')
+			}
+			boundary = false
+			text.WriteRune(r)
+		}
+	}
+
+	return strings.Join(strings.Fields(xmlUnescaper.Replace(text.String())), " ")
+}
+
+// validateProsody checks the relative prosody values against the ranges Alexa
+// supports. Named values are not checked.
+func validateProsody(rate, pitch, volume string) error {
+	if strings.HasSuffix(rate, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(rate, "%"), 64)
+		if err != nil || percent <= 0 {
+			return fmt.Errorf("Prosody rate %q must be a positive percentage.", rate)
+		}
+	}
+
+	if strings.HasSuffix(pitch, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(pitch, "%"), 64)
+		if err != nil || percent < minProsodyPitch || percent > maxProsodyPitch {
+			return fmt.Errorf("Prosody pitch %q must be between %g%% and %+g%%.", pitch, minProsodyPitch, maxProsodyPitch)
+		}
+	}
+
+	if strings.HasSuffix(pitch, "st") {
+		semitones, err := strconv.ParseFloat(strings.TrimSuffix(pitch, "st"), 64)
+		if err != nil || semitones < minProsodySemitones || semitones > maxProsodySemitones {
+			return fmt.Errorf("Prosody pitch %q must be between %dst and %+dst.", pitch, minProsodySemitones, maxProsodySemitones)
+		}
+	}
+
+	if strings.HasSuffix(volume, "dB") {
+		db, err := strconv.ParseFloat(strings.TrimSuffix(volume, "dB"), 64)
+		if err != nil || db < minProsodyVolume || db > maxProsodyVolume {
+			return fmt.Errorf("Prosody volume %q must be between %gdB and %+gdB.", volume, minProsodyVolume, maxProsodyVolume)
+		}
+	}
+
+	return nil
+}
+
+// prosodyAttributes returns the attributes of a prosody element for opts, with
+// a leading space, or an error if opts are conflicting, empty or out of range.
+func prosodyAttributes(opts ProsodyOptions) (string, error) {
+	if opts.Rate != "" && opts.RatePercent != nil {
+		return "", fmt.Errorf("Prosody rate given both as %q and as a percentage.", opts.Rate)
+	}
+
+	if opts.Pitch != "" && opts.PitchPercent != nil {
+		return "", fmt.Errorf("Prosody pitch given both as %q and as a percentage.", opts.Pitch)
+	}
+
+	if opts.PitchSemitones != nil && (opts.Pitch != "" || opts.PitchPercent != nil) {
+		return "", errors.New("Prosody pitch given both in semitones and another way.")
+	}
+
+	if opts.Volume != "" && opts.VolumeDB != nil {
+		return "", fmt.Errorf("Prosody volume given both as %q and in decibels.", opts.Volume)
+	}
+
+	rate, pitch, volume := opts.Rate, opts.Pitch, opts.Volume
+
+	if opts.RatePercent != nil {
+		rate = fmt.Sprintf("%d%%", *opts.RatePercent)
+	}
+
+	if opts.PitchPercent != nil {
+		pitch = fmt.Sprintf("%+d%%", *opts.PitchPercent)
+	}
+
+	if opts.PitchSemitones != nil {
+		pitch = fmt.Sprintf("%+dst", *opts.PitchSemitones)
+	}
+
+	if opts.VolumeDB != nil {
+		volume = fmt.Sprintf("%+ddB", *opts.VolumeDB)
+	}
+
+	if err := validateProsody(rate, pitch, volume); err != nil {
+		return "", err
+	}
+
+	if rate == "" && pitch == "" && volume == "" {
+		return "", errors.New("Prosody needs at least one of rate, pitch or volume.")
+	}
+
+	attrs := ""
+
+	if rate != "" {
+		attrs += fmt.Sprintf(" rate=\"%s\"", xmlEscaper.Replace(rate))
+	}
+
+	if pitch != "" {
+		attrs += fmt.Sprintf(" pitch=\"%s\"", xmlEscaper.Replace(pitch))
+	}
+
+	if volume != "" {
+		attrs += fmt.Sprintf(" volume=\"%s\"", xmlEscaper.Replace(volume))
+	}
+
+	return attrs, nil
+}
+
+// dateLayouts maps the DateFormat* constants to the time layout that writes a
+// date in that format.
+var dateLayouts = map[string]string{
+	DateFormatMDY: "01-02-2006",
+	DateFormatDMY: "02-01-2006",
+	DateFormatYMD: "2006-01-02",
+	DateFormatMD:  "01-02",
+	DateFormatDM:  "02-01",
+	DateFormatYM:  "2006-01",
+	DateFormatMY:  "01-2006",
+	DateFormatD:   "02",
+	DateFormatM:   "01",
+	DateFormatY:   "2006",
+}
+
+// dateLayout returns the time layout that writes a date in the given say-as
+// date format, which must be one of the DateFormat* constants.
+func dateLayout(format string) (string, error) {
+	if format == "" {
+		return "", errors.New("Say-as date format must not be empty.")
+	}
+
+	layout, ok := dateLayouts[format]
+	if !ok {
+		return "", fmt.Errorf("Unsupported say-as date format %q.", format)
+	}
+
+	return layout, nil
+}
+
+// localeDateFormat returns the order dates are usually read in for locale.
+func localeDateFormat(locale string) string {
+	switch locale {
+	case "en-US", "en-CA", "es-US":
+		return DateFormatMDY
+	case "ja-JP":
+		return DateFormatYMD
+	}
+
+	return DateFormatDMY
+}
+
+// abbreviations holds words ending in a period that do not end a sentence.
+var abbreviations = map[string]bool{
+	"dr.":   true,
+	"e.g.":  true,
+	"i.e.":  true,
+	"jr.":   true,
+	"mr.":   true,
+	"mrs.":  true,
+	"ms.":   true,
+	"prof.": true,
+	"sr.":   true,
+	"st.":   true,
+	"vs.":   true,
+}
+
+// splitSentences splits text into trimmed, non-empty sentences.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+
+	for i, r := range text {
+		if r != '.' && r != '!' && r != '?' {
+			continue
+		}
+
+		end := i + 1
+		if end < len(text) && text[end] != ' ' && text[end] != '\n' && text[end] != '\t' {
+			continue
+		}
+
+		sentence := strings.TrimSpace(text[start:end])
+		words := strings.Fields(sentence)
+		if r == '.' && len(words) > 0 && abbreviations[strings.ToLower(words[len(words)-1])] {
+			continue
+		}
+
+		if sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = end
+	}
+
+	if rest := strings.TrimSpace(text[start:]); rest != "" {
+		sentences = append(sentences, rest)
+	}
+
+	return sentences
+}
+
+// chunkBoundaries returns the offsets in ssml where it can be split without
+// breaking an element: the end of every top-level element and the end of every
+// sentence in top-level text. The last offset is always len(ssml).
+func chunkBoundaries(ssml string) []int {
+	var boundaries []int
+	depth := 0
+
+	for i := 0; i < len(ssml); i++ {
+		switch c := ssml[i]; {
+		case c == '<':
+			end := strings.IndexByte(ssml[i:], '>')
+			if end < 0 {
+				i = len(ssml)
+				break
+			}
+			tag := ssml[i : i+end+1]
+			i += end
+
+			switch {
+			case strings.HasPrefix(tag, "</"):
+				depth--
+			case !strings.HasSuffix(tag, "/>"):
+				depth++
+			}
+
+			if depth == 0 {
+				boundaries = append(boundaries, i+1)
+			}
+		case depth == 0 && (c == '.' || c == '!' || c == '?'):
+			if i+1 < len(ssml) && ssml[i+1] != ' ' && ssml[i+1] != '\n' && ssml[i+1] != '\t' {
+				continue
+			}
+
+			// Only the word before the period matters, so look back to the
+			// previous space or tag rather than rescanning all of ssml.
+			word := ssml[strings.LastIndexAny(ssml[:i], " \t\n\r>")+1 : i+1]
+			if c == '.' && abbreviations[strings.ToLower(word)] {
+				continue
+			}
+
+			boundaries = append(boundaries, i+1)
+		}
+	}
+
+	if len(boundaries) == 0 || boundaries[len(boundaries)-1] != len(ssml) {
+		boundaries = append(boundaries, len(ssml))
+	}
+
+	return boundaries
+}
+
+// validateSSML checks that ssml is a single well-formed speak element, only
+// uses elements Alexa supports, does not nest them in ways Alexa forbids and
+// does not give a prosody element both a rate and a duration.
+func validateSSML(ssml string) error {
+	decoder := xml.NewDecoder(strings.NewReader(ssml))
+	open := map[string]int{}
+	depth, rooted := 0, false
+
+	for {
+		offset := decoder.InputOffset()
+
+		token, err := decoder.Token()
+		if err == io.EOF {
+			if !rooted {
+				return errors.New("SSML has no speak element.")
+			}
+
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid SSML at offset %d: %s", offset, err)
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			tag := tagName(element.Name)
+			if depth == 0 && (rooted || tag != "speak") {
+				return fmt.Errorf("SSML must be a single speak element, found <%s> at offset %d.", tag, offset)
+			}
+
+			if !supportedTags[tag] {
+				return fmt.Errorf("Unsupported SSML tag <%s> at offset %d.", tag, offset)
+			}
+
+			if tag == "prosody" && hasAttr(element, "rate") && hasAttr(element, "duration") {
+				return fmt.Errorf("SSML prosody at offset %d has both a rate and a duration.", offset)
+			}
+
+			for _, parent := range disallowedParents[tag] {
+				if open[parent] > 0 {
+					return fmt.Errorf("SSML tag <%s> is not allowed inside <%s> at offset %d.", tag, parent, offset)
+				}
+			}
+
+			open[tag]++
+			depth++
+			rooted = true
+		case xml.EndElement:
+			open[tagName(element.Name)]--
+			depth--
+		case xml.CharData:
+			if depth == 0 && len(bytes.TrimSpace(element)) > 0 {
+				return fmt.Errorf("SSML has text outside the speak element at offset %d.", offset)
+			}
+		}
+	}
+}
+
+// hasAttr reports whether element has an attribute with the given local name.
+func hasAttr(element xml.StartElement, name string) bool {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tagName returns name as written in SSML, including any prefix.
+func tagName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+
+	return name.Space + ":" + name.Local
+}
+
 // Helper Types
 
-type SSMLTextBuilder struct {
-	buffer *bytes.Buffer
+type SSMLTextBuilder struct {
+	buffer         *bytes.Buffer
+	err            error
+	wordsPerMinute int
+	maxLen         int
+	rawText        bool
+	requireMP3     bool
+	customEmphasis bool
+	strict         bool
+	locale         string
+	autoSpace      bool
+	speakLang      string
+	elementBudget  int
+	elements       int
+	lastPlain      bool
+	pendingComma   bool
+	audioCount     int
+}
+
+// SSMLOption configures an SSMLTextBuilder when it is created.
+type SSMLOption func(*SSMLTextBuilder)
+
+// WithAutoEscape sets whether text passed to the Append methods is
+// XML-escaped, which is the default. Attribute values are always escaped.
+func WithAutoEscape(escape bool) SSMLOption {
+	return func(builder *SSMLTextBuilder) {
+		builder.rawText = !escape
+	}
+}
+
+// WithRequireMP3 makes AppendAudio reject sources whose path does not end in
+// ".mp3".
+func WithRequireMP3(require bool) SSMLOption {
+	return func(builder *SSMLTextBuilder) {
+		builder.requireMP3 = require
+	}
+}
+
+// WithAutoSpace makes consecutive AppendPlainSpeech calls separated by a
+// single space, so chunks of text do not run into each other.
+func WithAutoSpace(autoSpace bool) SSMLOption {
+	return func(builder *SSMLTextBuilder) {
+		builder.autoSpace = autoSpace
+	}
+}
+
+// WithCapacity preallocates room for n bytes of content, avoiding repeated
+// buffer growth when assembling long responses. An n of zero or less is
+// ignored.
+func WithCapacity(n int) SSMLOption {
+	return func(builder *SSMLTextBuilder) {
+		if n > 0 {
+			builder.buffer.Grow(n)
+		}
+	}
+}
+
+// WithCustomEmphasis makes AppendEmphasis accept levels other than the
+// Emphasis* constants.
+func WithCustomEmphasis(allow bool) SSMLOption {
+	return func(builder *SSMLTextBuilder) {
+		builder.customEmphasis = allow
+	}
+}
+
+// WithSpeakLang sets the xml:lang attribute of the speak element, i.e. the
+// language of the whole document. A locale Alexa does not support is recorded
+// as an error, see Err.
+func WithSpeakLang(locale string) SSMLOption {
+	return func(builder *SSMLTextBuilder) {
+		if !langLocales[locale] {
+			builder.fail(fmt.Errorf("Unsupported speak locale %q.", locale))
+			return
+		}
+
+		builder.speakLang = locale
+	}
+}
+
+// WithStrictTags makes the Append methods reject attribute values Alexa does
+// not document, such as an unknown break strength.
+func WithStrictTags(strict bool) SSMLOption {
+	return func(builder *SSMLTextBuilder) {
+		builder.strict = strict
+	}
+}
+
+// WithLocale sets the locale the skill speaks in, e.g. "en-GB". It picks the
+// default date format of AppendDate and, if speechcons have been registered
+// for the locale with RegisterSpeechcons, the speechcons AppendInterjection
+// accepts. A locale Alexa does not support is recorded as an error, see Err.
+func WithLocale(locale string) SSMLOption {
+	return func(builder *SSMLTextBuilder) {
+		if !langLocales[locale] {
+			builder.fail(fmt.Errorf("Unsupported locale %q.", locale))
+			return
+		}
+
+		builder.locale = locale
+	}
+}
+
+// WithElementBudget limits the total number of elements the builder may hold.
+// An Append that would go over the budget is recorded as an error, see Err.
+func WithElementBudget(n int) SSMLOption {
+	return func(builder *SSMLTextBuilder) {
+		builder.elementBudget = n
+	}
+}
+
+// WithMaxLen sets the limit BuildWithLimit uses when it is given no max.
+func WithMaxLen(max int) SSMLOption {
+	return func(builder *SSMLTextBuilder) {
+		builder.maxLen = max
+	}
+}
+
+// WithWPM sets the speaking rate used by EstimateDuration.
+func WithWPM(wpm int) SSMLOption {
+	return func(builder *SSMLTextBuilder) {
+		builder.wordsPerMinute = wpm
+	}
+}
+
+// AudioOptions holds the optional attributes of an audio element. Zero values
+// are left out of the markup.
+type AudioOptions struct {
+	ClipBegin   time.Duration
+	ClipEnd     time.Duration
+	RepeatCount int
+	SoundLevel  int // In decibels, relative to the original volume.
+
+	// Fallback is spoken instead of the audio if the file cannot be played.
+	// It must not contain audio itself.
+	Fallback *SSMLTextBuilder
+}
+
+// ProsodyOptions holds the values of a prosody element for AppendProsodyOpts.
+// The named levels are given as strings, e.g. RateSlow, and the relative
+// values as numbers. The pitch can also be given in semitones. Unset values
+// are left out of the markup.
+type ProsodyOptions struct {
+	Rate           string
+	RatePercent    *int
+	Pitch          string
+	PitchPercent   *int
+	PitchSemitones *int
+	Volume         string
+	VolumeDB       *int
+}
+
+// OutputMode selects how an Output is rendered.
+type OutputMode int
+
+// Output modes understood by Output.
+const (
+	// OutputSSML renders the content as a speak document.
+	OutputSSML OutputMode = iota
+	// OutputPlainText renders the content with all markup removed.
+	OutputPlainText
+)
+
+// Output renders the content of a builder as either SSML or plain text, so a
+// handler can produce both kinds of output speech from one source.
+type Output struct {
+	Builder *SSMLTextBuilder
+	Mode    OutputMode
+}
+
+func NewSSMLTextBuilder(opts ...SSMLOption) *SSMLTextBuilder {
+	builder := &SSMLTextBuilder{buffer: bytes.NewBufferString("")}
+
+	for _, opt := range opts {
+		opt(builder)
+	}
+
+	return builder
+}
+
+// builderPool recycles builders for GetSSMLTextBuilder and PutSSMLTextBuilder.
+var builderPool = sync.Pool{
+	New: func() interface{} {
+		return NewSSMLTextBuilder()
+	},
+}
+
+// GetSSMLTextBuilder returns an empty builder with default options from a
+// shared pool. Skills handling many requests can use it together with
+// PutSSMLTextBuilder to avoid allocating a new buffer for every response.
+func GetSSMLTextBuilder() *SSMLTextBuilder {
+	return builderPool.Get().(*SSMLTextBuilder)
+}
+
+// PutSSMLTextBuilder resets builder and returns it to the pool. The builder
+// must not be used again after it has been put back.
+func PutSSMLTextBuilder(builder *SSMLTextBuilder) {
+	buffer := builder.buffer
+	buffer.Reset()
+	*builder = SSMLTextBuilder{buffer: buffer}
+
+	builderPool.Put(builder)
+}
+
+// ValidBreakStrength reports whether strength is one of the Break* constants.
+func ValidBreakStrength(strength string) bool {
+	switch strength {
+	case BreakNone, BreakXWeak, BreakWeak, BreakMedium, BreakStrong, BreakXStrong:
+		return true
+	}
+
+	return false
+}
+
+// ValidEmphasisLevel reports whether level is one of the Emphasis* constants.
+func ValidEmphasisLevel(level string) bool {
+	switch level {
+	case EmphasisStrong, EmphasisModerate, EmphasisReduced, EmphasisNone:
+		return true
+	}
+
+	return false
+}
+
+// Speak returns text, escaped, as a complete speak document. It fails if the
+// result is longer than MaxOutputLength.
+func Speak(text string) (string, error) {
+	return NewSSMLTextBuilder().AppendPlainSpeech(text).BuildWithLimit(0)
+}
+
+// ValidVoice reports whether name is one of the Voice* constants.
+func ValidVoice(name string) bool {
+	return voices[name]
+}
+
+// ParseSSML loads the content of an existing speak document into a new builder
+// so more content can be appended to it, keeping the xml:lang of the speak
+// element if it has one. Audio and other elements in the content count
+// towards MaxAudioCount and WithElementBudget like appended ones. Input that
+// is not a single speak element Validate would accept, or that holds more than
+// MaxAudioCount audio elements, is rejected.
+func ParseSSML(ssml string) (*SSMLTextBuilder, error) {
+	ssml = strings.TrimSpace(ssml)
+
+	if err := validateSSML(ssml); err != nil {
+		return nil, err
+	}
+
+	match := speakDocument.FindStringSubmatch(ssml)
+	if match == nil {
+		return nil, errors.New("SSML must be wrapped in <speak>...</speak>.")
+	}
+
+	builder := &SSMLTextBuilder{buffer: bytes.NewBufferString(match[2])}
+	if match[1] != "" {
+		WithSpeakLang(match[1])(builder)
+	}
+
+	if builder.err != nil {
+		return nil, builder.err
+	}
+
+	counts := builder.Counts()
+	for _, count := range counts {
+		builder.elements += count
+	}
+
+	builder.audioCount = counts["audio"]
+	if builder.audioCount > MaxAudioCount {
+		return nil, fmt.Errorf("A response can contain at most %d audio files.", MaxAudioCount)
+	}
+
+	return builder, nil
+}
+
+// AudioCount returns the number of audio elements appended so far.
+func (builder *SSMLTextBuilder) AudioCount() int {
+	return builder.audioCount
+}
+
+// SSMLFromTemplate executes tmpl with data and loads the output, which must be
+// SSML content without the speak wrapper, into a new builder. Template values
+// are not escaped, so the output is loaded with AppendSSML, which checks it
+// and counts its audio towards MaxAudioCount.
+func SSMLFromTemplate(tmpl *template.Template, data interface{}) (*SSMLTextBuilder, error) {
+	builder := NewSSMLTextBuilder()
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, err
+	}
+
+	if err := builder.AppendSSML(out.String()).Err(); err != nil {
+		return nil, err
+	}
+
+	return builder, nil
+}
+
+// Err returns the first validation error hit by an Append method, if any. Once
+// an error is recorded later Append calls are ignored, so a chain of appends
+// only needs to be checked once at the end.
+func (builder *SSMLTextBuilder) Err() error {
+	return builder.err
+}
+
+// Clone returns an independent copy of the builder, so different content can be
+// appended to each.
+func (builder *SSMLTextBuilder) Clone() *SSMLTextBuilder {
+	clone := *builder
+	clone.buffer = bytes.NewBuffer(append([]byte(nil), builder.buffer.Bytes()...))
+
+	return &clone
+}
+
+// Reset removes all content and any recorded error, keeping the builder's
+// options.
+func (builder *SSMLTextBuilder) Reset() *SSMLTextBuilder {
+	builder.buffer.Reset()
+	builder.err = nil
+	builder.audioCount = 0
+	builder.elements = 0
+	builder.lastPlain = false
+	builder.pendingComma = false
+
+	return builder
+}
+
+// Grow makes room for n more bytes of content, like WithCapacity but at any
+// point while building. It does not change the content. An n of zero or less
+// is ignored.
+func (builder *SSMLTextBuilder) Grow(n int) *SSMLTextBuilder {
+	if n > 0 {
+		builder.buffer.Grow(n)
+	}
+
+	return builder
+}
+
+// SetWordsPerMinute sets the speaking rate used by EstimateDuration.
+func (builder *SSMLTextBuilder) SetWordsPerMinute(wpm int) *SSMLTextBuilder {
+	builder.wordsPerMinute = wpm
+
+	return builder
+}
+
+// Must panics if an Append method has failed, and otherwise returns the
+// builder. It is meant for fixtures and scripts, in the spirit of
+// regexp.MustCompile.
+func (builder *SSMLTextBuilder) Must() *SSMLTextBuilder {
+	if builder.err != nil {
+		panic(builder.err)
+	}
+
+	return builder
+}
+
+// fail records err unless an earlier error has already been recorded.
+func (builder *SSMLTextBuilder) fail(err error) *SSMLTextBuilder {
+	if builder.err == nil {
+		builder.err = err
+	}
+
+	return builder
+}
+
+// escape XML-escapes text unless auto-escaping has been turned off.
+func (builder *SSMLTextBuilder) escape(text string) string {
+	if builder.rawText {
+		return text
+	}
+
+	return xmlEscaper.Replace(text)
+}
+
+// appendContent builds nested content with fn on a builder sharing this
+// builder's options and wraps it in the open and close tags.
+func (builder *SSMLTextBuilder) appendContent(open, close string, fn func(*SSMLTextBuilder)) *SSMLTextBuilder {
+
+	if builder.err != nil {
+		return builder
+	}
+
+	inner := *builder
+	inner.buffer = new(bytes.Buffer)
+	inner.lastPlain = false
+	inner.pendingComma = false
+	fn(&inner)
+
+	if inner.err != nil {
+		return builder.fail(inner.err)
+	}
+
+	builder.write(open, inner.buffer.String(), close)
+
+	if builder.err == nil {
+		builder.audioCount = inner.audioCount
+	}
+
+	return builder
+}
+
+// speakTag returns the opening speak tag, with the xml:lang from WithSpeakLang
+// if it was set.
+func (builder *SSMLTextBuilder) speakTag() string {
+	if builder.speakLang == "" {
+		return "<speak>"
+	}
+
+	return "<speak xml:lang=\"" + builder.speakLang + "\">"
+}
+
+// write appends the ssml pieces to the buffer unless an error has been
+// recorded, which turns every Append method into a no-op after the first
+// failure. Passing pieces rather than a formatted string saves an allocation
+// on the most common Append paths.
+func (builder *SSMLTextBuilder) write(ssml ...string) *SSMLTextBuilder {
+	if builder.err == nil && builder.elementBudget > 0 {
+		elements := builder.elements
+		for _, piece := range ssml {
+			elements += len(startTag.FindAllStringIndex(piece, -1))
+		}
+
+		if elements > builder.elementBudget {
+			return builder.fail(fmt.Errorf("SSML would contain %d elements, over the budget of %d.", elements, builder.elementBudget))
+		}
+
+		builder.elements = elements
+	}
+
+	if builder.err == nil {
+		if builder.pendingComma {
+			builder.writeComma(strings.Join(ssml, ""))
+		}
+
+		for _, piece := range ssml {
+			builder.buffer.WriteString(piece)
+		}
+		builder.lastPlain = false
+	}
+
+	return builder
+}
+
+// writeComma writes the comma a spaced AppendInterjection left pending, unless
+// next is empty or starts with punctuation, in which case it waits or is
+// dropped.
+func (builder *SSMLTextBuilder) writeComma(next string) {
+	if next == "" {
+		return
+	}
+
+	builder.pendingComma = false
+
+	switch {
+	case strings.ContainsRune(".,;:!?", rune(next[0])):
+	case next[0] == ' ':
+		builder.buffer.WriteString(",")
+	default:
+		builder.buffer.WriteString(", ")
+	}
+}
+
+// AppendPlainSpeech appends text without any markup. With WithAutoSpace a
+// space is put between two consecutive plain speech appends if neither side
+// has one.
+func (builder *SSMLTextBuilder) AppendPlainSpeech(text string) *SSMLTextBuilder {
+	return builder.appendPlain(builder.escape(text))
+}
+
+// AppendPlainSpeechRaw is like AppendPlainSpeech but never escapes text, even
+// when the builder escapes by default. The caller must make sure text is
+// already escaped.
+func (builder *SSMLTextBuilder) AppendPlainSpeechRaw(text string) *SSMLTextBuilder {
+	return builder.appendPlain(text)
+}
+
+// appendPlain appends already escaped plain speech, applying WithAutoSpace.
+func (builder *SSMLTextBuilder) appendPlain(text string) *SSMLTextBuilder {
+
+	if builder.autoSpace && builder.lastPlain && text != "" &&
+		!strings.HasPrefix(text, " ") && !bytes.HasSuffix(builder.buffer.Bytes(), []byte(" ")) {
+		builder.write(" ")
+	}
+
+	builder.write(text)
+
+	if builder.err == nil {
+		builder.lastPlain = true
+	}
+
+	return builder
+}
+
+// AppendAddress reads text as a street address, e.g. "150 E Dana St".
+func (builder *SSMLTextBuilder) AppendAddress(text string) *SSMLTextBuilder {
+	return builder.AppendSayAs(text, SayAsAddress)
+}
+
+func (builder *SSMLTextBuilder) AppendAmazonEffect(text, name string) *SSMLTextBuilder {
+
+	builder.write("<amazon:effect name=\"", xmlEscaper.Replace(name), "\">", builder.escape(text), "</amazon:effect>")
+
+	return builder
+}
+
+// AppendAudio plays the MP3 at src. A src that is not an HTTPS URL is recorded
+// as an error, see Err.
+func (builder *SSMLTextBuilder) AppendAudio(src string) *SSMLTextBuilder {
+	return builder.AppendAudioWithOptions(src, AudioOptions{})
+}
+
+// AppendAudioWithOptions is like AppendAudio but also sets the attributes in
+// opts that are non-zero. Negative clip times, a clip end before the clip
+// begin, a repeat count above 10 and a sound level outside -6dB to +6dB are
+// recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendAudioWithOptions(src string, opts AudioOptions) *SSMLTextBuilder {
+
+	link, err := url.Parse(src)
+	if err != nil || link.Scheme != "https" {
+		return builder.fail(fmt.Errorf("Audio src %q is not an HTTPS URL.", src))
+	}
+
+	if builder.requireMP3 && !strings.HasSuffix(strings.ToLower(link.Path), ".mp3") {
+		return builder.fail(fmt.Errorf("Audio src %q is not an MP3 file.", src))
+	}
+
+	if builder.audioCount >= MaxAudioCount {
+		return builder.fail(fmt.Errorf("A response can contain at most %d audio files.", MaxAudioCount))
+	}
+
+	if opts.ClipBegin < 0 || opts.ClipEnd < 0 {
+		return builder.fail(errors.New("Audio clip times must not be negative."))
+	}
+
+	if opts.ClipEnd != 0 && opts.ClipEnd <= opts.ClipBegin {
+		return builder.fail(fmt.Errorf("Audio clip end %s must be after the clip begin %s.", opts.ClipEnd, opts.ClipBegin))
+	}
+
+	if opts.RepeatCount < 0 || opts.RepeatCount > maxRepeatCount {
+		return builder.fail(fmt.Errorf("Audio repeat count %d must be between 1 and %d.", opts.RepeatCount, maxRepeatCount))
+	}
+
+	if opts.SoundLevel < minSoundLevel || opts.SoundLevel > maxSoundLevel {
+		return builder.fail(fmt.Errorf("Audio sound level %+ddB must be between %ddB and %+ddB.", opts.SoundLevel, minSoundLevel, maxSoundLevel))
+	}
+
+	attrs := ""
+
+	if opts.ClipBegin != 0 {
+		attrs += fmt.Sprintf(" clipBegin=\"%dms\"", opts.ClipBegin/time.Millisecond)
+	}
+
+	if opts.ClipEnd != 0 {
+		attrs += fmt.Sprintf(" clipEnd=\"%dms\"", opts.ClipEnd/time.Millisecond)
+	}
+
+	if opts.RepeatCount != 0 {
+		attrs += fmt.Sprintf(" repeatCount=\"%d\"", opts.RepeatCount)
+	}
+
+	if opts.SoundLevel != 0 {
+		attrs += fmt.Sprintf(" soundLevel=\"%+ddB\"", opts.SoundLevel)
+	}
+
+	ssml := fmt.Sprintf("<audio src=\"%s\"%s/>", xmlEscaper.Replace(src), attrs)
+
+	if opts.Fallback != nil {
+		if opts.Fallback.err != nil {
+			return builder.fail(opts.Fallback.err)
+		}
+
+		// Alexa does not allow audio inside audio, so the fallback cannot
+		// play a file of its own.
+		if opts.Fallback.Counts()["audio"] > 0 {
+			return builder.fail(errors.New("Audio fallback must not contain audio."))
+		}
+
+		ssml = fmt.Sprintf("<audio src=\"%s\"%s>%s</audio>", xmlEscaper.Replace(src), attrs, opts.Fallback.buffer.String())
+	}
+
+	builder.write(ssml)
+
+	if builder.err == nil {
+		builder.audioCount++
+	}
+
+	return builder
+}
+
+// AppendBreak adds a pause. An empty strength or a zero duration leaves that
+// attribute out, so Alexa falls back to its default medium pause. A negative
+// duration or one longer than 10 seconds is recorded as an error, see Err, as
+// is an unknown strength when the builder was created with WithStrictTags.
+func (builder *SSMLTextBuilder) AppendBreak(strength string, duration time.Duration) *SSMLTextBuilder {
+
+	if builder.strict && strength != "" && !ValidBreakStrength(strength) {
+		return builder.fail(fmt.Errorf("Invalid break strength %q.", strength))
+	}
+
+	if err := validateBreakDuration(duration); err != nil {
+		return builder.fail(err)
+	}
+
+	// Some clients are picky about attribute order, so strength always comes
+	// before time, matching Alexa's documentation. When both are given Alexa
+	// uses the time.
+	attrs := ""
+
+	if strength != "" {
+		attrs += fmt.Sprintf(" strength=\"%s\"", xmlEscaper.Replace(strength))
+	}
+
+	// Alexa only takes whole milliseconds, so round up rather than turn a
+	// very short pause into time="0ms".
+	if duration != 0 {
+		attrs += fmt.Sprintf(" time=\"%dms\"", (duration+time.Millisecond-1)/time.Millisecond)
+	}
+
+	builder.write(fmt.Sprintf("<break%s/>", attrs))
+
+	return builder
+}
+
+// AppendBreakMillis adds a pause of ms milliseconds, e.g. from configuration.
+// A value outside 1 to 10000 is recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendBreakMillis(ms int) *SSMLTextBuilder {
+
+	if ms <= 0 {
+		return builder.fail(fmt.Errorf("Break of %dms must be at least 1ms.", ms))
+	}
+
+	duration := time.Duration(ms) * time.Millisecond
+	if err := validateBreakDuration(duration); err != nil {
+		return builder.fail(err)
+	}
+
+	return builder.AppendBreakTime(duration)
+}
+
+// AppendBreakStrength adds a pause of the given strength, e.g. BreakStrong.
+func (builder *SSMLTextBuilder) AppendBreakStrength(strength string) *SSMLTextBuilder {
+	return builder.AppendBreak(strength, 0)
+}
+
+// AppendBreakTime adds a pause of the given duration, at most 10 seconds.
+func (builder *SSMLTextBuilder) AppendBreakTime(duration time.Duration) *SSMLTextBuilder {
+	return builder.AppendBreak("", duration)
+}
+
+// AppendBuilder appends the content of other, without its speak wrapper, so
+// that separately built fragments can be composed. An error recorded on other
+// is carried over to builder. To place content inside an element use the
+// Content variants, e.g. AppendProsodyContent.
+func (builder *SSMLTextBuilder) AppendBuilder(other *SSMLTextBuilder) *SSMLTextBuilder {
+
+	if other.err != nil {
+		return builder.fail(other.err)
+	}
+
+	if builder.audioCount+other.audioCount > MaxAudioCount {
+		return builder.fail(fmt.Errorf("A response can contain at most %d audio files.", MaxAudioCount))
+	}
+
+	builder.write(other.buffer.String())
+
+	if builder.err == nil {
+		builder.audioCount += other.audioCount
+	}
+
+	return builder
+}
+
+// AppendCharacters reads text one character at a time. A non-empty locale,
+// e.g. "fr-FR", wraps the characters in a lang element so accented letters are
+// named in that language; an unsupported locale is recorded as an error, see
+// Err.
+func (builder *SSMLTextBuilder) AppendCharacters(text, locale string) *SSMLTextBuilder {
+
+	if locale == "" {
+		return builder.AppendSayAs(text, SayAsCharacters)
+	}
+
+	if !langLocales[locale] {
+		return builder.fail(fmt.Errorf("Unsupported lang locale %q.", locale))
+	}
+
+	builder.write(fmt.Sprintf("<lang xml:lang=\"%s\"><say-as interpret-as=\"%s\">%s</say-as></lang>", xmlEscaper.Replace(locale), SayAsCharacters, builder.escape(text)))
+
+	return builder
+}
+
+// AppendCurrency reads amount as a dollar amount, e.g. "5.99" or "$5.99" as
+// "five dollars and ninety-nine cents". A missing $ sign is added, after the
+// minus sign of a negative amount, so "-5" is written as -$5.
+func (builder *SSMLTextBuilder) AppendCurrency(amount string) *SSMLTextBuilder {
+
+	amount = strings.TrimSpace(amount)
+
+	sign := ""
+	if strings.HasPrefix(amount, "-") {
+		sign, amount = "-", amount[1:]
+	}
+
+	if !strings.HasPrefix(amount, "$") {
+		amount = "$" + amount
+	}
+
+	return builder.AppendUnit(sign + amount)
+}
+
+// AppendDate reads t as a date in the given say-as date format, e.g.
+// DateFormatMDY writes it as "11-23-2024". An empty format uses the usual
+// order for the builder's locale, see WithLocale. Formats other than the
+// DateFormat* constants are recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendDate(t time.Time, format string) *SSMLTextBuilder {
+
+	if format == "" && builder.locale != "" {
+		format = localeDateFormat(builder.locale)
+	}
+
+	layout, err := dateLayout(format)
+	if err != nil {
+		return builder.fail(err)
+	}
+
+	return builder.AppendSayAsDate(t.Format(layout), format)
+}
+
+// AppendMonthDayYear reads t as a date written like "11-23-2024".
+func (builder *SSMLTextBuilder) AppendMonthDayYear(t time.Time) *SSMLTextBuilder {
+	return builder.AppendDate(t, DateFormatMDY)
+}
+
+// AppendDayMonthYear reads t as a date written like "23-11-2024".
+func (builder *SSMLTextBuilder) AppendDayMonthYear(t time.Time) *SSMLTextBuilder {
+	return builder.AppendDate(t, DateFormatDMY)
+}
+
+// AppendYearMonthDay reads t as a date written like "2024-11-23".
+func (builder *SSMLTextBuilder) AppendYearMonthDay(t time.Time) *SSMLTextBuilder {
+	return builder.AppendDate(t, DateFormatYMD)
+}
+
+// AppendMonthDay reads t as a date written like "11-23".
+func (builder *SSMLTextBuilder) AppendMonthDay(t time.Time) *SSMLTextBuilder {
+	return builder.AppendDate(t, DateFormatMD)
+}
+
+// AppendDayMonth reads t as a date written like "23-11".
+func (builder *SSMLTextBuilder) AppendDayMonth(t time.Time) *SSMLTextBuilder {
+	return builder.AppendDate(t, DateFormatDM)
+}
+
+// AppendYearMonth reads t as a date written like "2024-11".
+func (builder *SSMLTextBuilder) AppendYearMonth(t time.Time) *SSMLTextBuilder {
+	return builder.AppendDate(t, DateFormatYM)
+}
+
+// AppendMonthYear reads t as a date written like "11-2024".
+func (builder *SSMLTextBuilder) AppendMonthYear(t time.Time) *SSMLTextBuilder {
+	return builder.AppendDate(t, DateFormatMY)
+}
+
+// AppendDayOnly reads t as a date written like "23".
+func (builder *SSMLTextBuilder) AppendDayOnly(t time.Time) *SSMLTextBuilder {
+	return builder.AppendDate(t, DateFormatD)
+}
+
+// AppendMonthOnly reads t as a date written like "11".
+func (builder *SSMLTextBuilder) AppendMonthOnly(t time.Time) *SSMLTextBuilder {
+	return builder.AppendDate(t, DateFormatM)
+}
+
+// AppendYearOnly reads t as a date written like "2024".
+func (builder *SSMLTextBuilder) AppendYearOnly(t time.Time) *SSMLTextBuilder {
+	return builder.AppendDate(t, DateFormatY)
+}
+
+// AppendDigits reads each digit of text individually, e.g. "1234" as "one two
+// three four". Unlike SayAsCharacters only digits are spelled out.
+func (builder *SSMLTextBuilder) AppendDigits(text string) *SSMLTextBuilder {
+	return builder.AppendSayAs(text, SayAsDigits)
+}
+
+// AppendDomain has text spoken in the named speaking style. An empty name is
+// recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendDomain(text, name string) *SSMLTextBuilder {
+
+	if name == "" {
+		return builder.fail(errors.New("Domain name must not be empty."))
+	}
+
+	builder.write(fmt.Sprintf("<amazon:domain name=\"%s\">%s</amazon:domain>", xmlEscaper.Replace(name), builder.escape(text)))
+
+	return builder
+}
+
+// AppendDomainContent is like AppendDomain but builds the content with fn, so
+// it can contain other elements such as breaks and emphasis.
+func (builder *SSMLTextBuilder) AppendDomainContent(name string, fn func(*SSMLTextBuilder)) *SSMLTextBuilder {
+
+	if name == "" {
+		return builder.fail(errors.New("Domain name must not be empty."))
+	}
+
+	return builder.appendContent(fmt.Sprintf("<amazon:domain name=\"%s\">", xmlEscaper.Replace(name)), "</amazon:domain>", fn)
+}
+
+// AppendEmotion has text spoken with the given emotion and intensity. An empty
+// intensity is recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendEmotion(text, name, intensity string) *SSMLTextBuilder {
+
+	if intensity == "" {
+		return builder.fail(errors.New("Emotion intensity must not be empty."))
+	}
+
+	builder.write(fmt.Sprintf("<amazon:emotion name=\"%s\" intensity=\"%s\">%s</amazon:emotion>", xmlEscaper.Replace(name), xmlEscaper.Replace(intensity), builder.escape(text)))
+
+	return builder
+}
+
+// AppendEmphasis has text spoken with the given emphasis level. A level that
+// is not one of the Emphasis* constants is recorded as an error, see Err,
+// unless the builder was created with WithCustomEmphasis.
+func (builder *SSMLTextBuilder) AppendEmphasis(text, level string) *SSMLTextBuilder {
+
+	if !builder.customEmphasis && !ValidEmphasisLevel(level) {
+		return builder.fail(fmt.Errorf("Invalid emphasis level %q.", level))
+	}
+
+	builder.write("<emphasis level=\"", xmlEscaper.Replace(level), "\">", builder.escape(text), "</emphasis>")
+
+	return builder
+}
+
+// AppendDurationSpoken reads d as a duration in the hms12 time format, e.g.
+// 81 seconds written as 1'21" and read as "one minute twenty-one seconds".
+// Durations of an hour or more are still given in minutes, e.g. 125'0", since
+// hms12 reads hours as a time of day. Fractions of a second are rounded away.
+// A negative duration is recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendDurationSpoken(d time.Duration) *SSMLTextBuilder {
+
+	if d < 0 {
+		return builder.fail(fmt.Errorf("Spoken duration %s must not be negative.", d))
+	}
+
+	seconds := int64((d + time.Second/2) / time.Second)
+
+	text := fmt.Sprintf("%d'%d\"", seconds/60, seconds%60)
+
+	builder.write("<say-as interpret-as=\"", SayAsTime, "\" format=\"hms12\">", builder.escape(text), "</say-as>")
+
+	return builder
+}
+
+// AppendEmphasisContent is like AppendEmphasis but builds the emphasized
+// content with fn, so it can contain other elements such as say-as.
+func (builder *SSMLTextBuilder) AppendEmphasisContent(level string, fn func(*SSMLTextBuilder)) *SSMLTextBuilder {
+
+	if !builder.customEmphasis && !ValidEmphasisLevel(level) {
+		return builder.fail(fmt.Errorf("Invalid emphasis level %q.", level))
+	}
+
+	return builder.appendContent(fmt.Sprintf("<emphasis level=\"%s\">", xmlEscaper.Replace(level)), "</emphasis>", fn)
 }
 
-func NewSSMLTextBuilder() *SSMLTextBuilder {
-	return &SSMLTextBuilder{bytes.NewBufferString("")}
+// AppendEmphasizedSentence reads text as a sentence spoken with the given
+// emphasis level, validated as in AppendEmphasis.
+func (builder *SSMLTextBuilder) AppendEmphasizedSentence(text, level string) *SSMLTextBuilder {
+	return builder.appendContent("<s>", "</s>", func(inner *SSMLTextBuilder) {
+		inner.AppendEmphasis(text, level)
+	})
 }
 
-func (builder *SSMLTextBuilder) AppendPlainSpeech(text string) *SSMLTextBuilder {
+// AppendExpletive bleeps text out.
+func (builder *SSMLTextBuilder) AppendExpletive(text string) *SSMLTextBuilder {
+	return builder.AppendSayAs(text, SayAsExpletive)
+}
+
+// AppendFraction reads text as a fraction, e.g. "3/4" or "1+1/2".
+func (builder *SSMLTextBuilder) AppendFraction(text string) *SSMLTextBuilder {
+	return builder.AppendSayAs(text, SayAsFraction)
+}
+
+// AppendIf calls fn with the builder only when cond is true, so conditional
+// content can be added without breaking a chain of appends.
+func (builder *SSMLTextBuilder) AppendIf(cond bool, fn func(*SSMLTextBuilder) *SSMLTextBuilder) *SSMLTextBuilder {
+
+	if !cond {
+		return builder
+	}
+
+	return fn(builder)
+}
+
+// AppendInterjection speaks text as a speechcon, e.g. "boing" or "abracadabra".
+// If spaced is true the speechcon is set off with commas, which gives it a
+// more natural pause, e.g. "Well, boing, that hurt." No comma is put after
+// punctuation or a space, before punctuation or at the end of the speech. If
+// speechcons have been registered for the builder's locale, see WithLocale and
+// RegisterSpeechcons, any other text is recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendInterjection(text string, spaced bool) *SSMLTextBuilder {
+
+	if !isSpeechcon(builder.locale, text) {
+		return builder.fail(fmt.Errorf("%q is not a speechcon in %s.", text, builder.locale))
+	}
+
+	if !spaced {
+		return builder.AppendSayAs(text, SayAsInterjection)
+	}
+
+	before := ", "
+	if content := builder.buffer.Bytes(); len(content) == 0 || bytes.ContainsAny(content[len(content)-1:], " .,;:!?") {
+		before = ""
+	}
+
+	builder.write(before, "<say-as interpret-as=\"", SayAsInterjection, "\">", builder.escape(text), "</say-as>")
 
-	builder.buffer.WriteString(text)
+	if builder.err == nil {
+		builder.pendingComma = true
+	}
 
 	return builder
 }
 
-func (builder *SSMLTextBuilder) AppendAmazonEffect(text, name string) *SSMLTextBuilder {
+// AppendLang has text spoken in the given locale, e.g. "es-ES". A locale Alexa
+// does not support is recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendLang(text, locale string) *SSMLTextBuilder {
+
+	if !langLocales[locale] {
+		return builder.fail(fmt.Errorf("Unsupported lang locale %q.", locale))
+	}
 
-	builder.buffer.WriteString(fmt.Sprintf("<amazon:effect name=\"%s\">%s</amazon:effect>", name, text))
+	builder.write(fmt.Sprintf("<lang xml:lang=\"%s\">%s</lang>", xmlEscaper.Replace(locale), builder.escape(text)))
 
 	return builder
 }
 
-func (builder *SSMLTextBuilder) AppendAudio(src string) *SSMLTextBuilder {
+// AppendList reads items as separate sentences with a break of the given
+// strength between each of them.
+func (builder *SSMLTextBuilder) AppendList(items []string, strength string) *SSMLTextBuilder {
+
+	for i, item := range items {
+		if i > 0 {
+			builder.AppendBreak(strength, 0)
+		}
 
-	builder.buffer.WriteString(fmt.Sprintf("<audio src=\"%s\"/>", src))
+		builder.AppendSentence(item)
+	}
 
 	return builder
 }
 
-func (builder *SSMLTextBuilder) AppendBreak(strength, time string) *SSMLTextBuilder {
+// AppendMark adds a named bookmark that clients can use to track playback. A
+// name that is not a valid XML name token is recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendMark(name string) *SSMLTextBuilder {
 
-	if strength == "" {
-		// The default strength is medium
-		strength = "medium"
+	if !markName.MatchString(name) {
+		return builder.fail(fmt.Errorf("Invalid mark name %q.", name))
 	}
 
-	builder.buffer.WriteString(fmt.Sprintf("<break strength=\"%s\" time=\"%s\"/>", strength, time))
+	builder.write(fmt.Sprintf("<mark name=\"%s\"/>", xmlEscaper.Replace(name)))
 
 	return builder
 }
 
-func (builder *SSMLTextBuilder) AppendEmphasis(text, level string) *SSMLTextBuilder {
+// AppendNumber reads n as a cardinal number.
+func (builder *SSMLTextBuilder) AppendNumber(n int) *SSMLTextBuilder {
+	return builder.AppendSayAs(strconv.Itoa(n), SayAsCardinal)
+}
 
-	builder.buffer.WriteString(fmt.Sprintf("<emphasis level=\"%s\">%s</emphasis>", level, text))
+// AppendNumberSpoken reads the number in text digit by digit if asDigits is
+// true, keeping leading zeros as in a code like "007", and otherwise as a
+// cardinal number, e.g. "007" as "seven".
+func (builder *SSMLTextBuilder) AppendNumberSpoken(text string, asDigits bool) *SSMLTextBuilder {
 
-	return builder
+	if asDigits {
+		return builder.AppendDigits(text)
+	}
+
+	return builder.AppendSayAs(text, SayAsCardinal)
+}
+
+// AppendOrdinal reads text as an ordinal number, e.g. "1" as "first".
+func (builder *SSMLTextBuilder) AppendOrdinal(text string) *SSMLTextBuilder {
+	return builder.AppendSayAs(text, SayAsOrdinal)
+}
+
+// AppendOrdinalNumber reads n as an ordinal number, e.g. 2 as "second".
+func (builder *SSMLTextBuilder) AppendOrdinalNumber(n int) *SSMLTextBuilder {
+	return builder.AppendSayAs(strconv.Itoa(n), SayAsOrdinal)
 }
 
 func (builder *SSMLTextBuilder) AppendParagraph(text string) *SSMLTextBuilder {
 
-	builder.buffer.WriteString(fmt.Sprintf("<p>%s</p>", text))
+	builder.write("<p>", builder.escape(text), "</p>")
+
+	return builder
+}
+
+// AppendParagraphs wraps each of texts in a paragraph element, in order.
+func (builder *SSMLTextBuilder) AppendParagraphs(texts []string) *SSMLTextBuilder {
+
+	for _, text := range texts {
+		builder.AppendParagraph(text)
+	}
+
+	return builder
+}
+
+// AppendPhonation has text spoken with the given phonation, e.g. PhonationSoft.
+func (builder *SSMLTextBuilder) AppendPhonation(text, phonation string) *SSMLTextBuilder {
+
+	builder.write(fmt.Sprintf("<amazon:effect phonation=\"%s\">%s</amazon:effect>", xmlEscaper.Replace(phonation), builder.escape(text)))
+
+	return builder
+}
+
+// AppendPhoneme wraps text in a phoneme element so Alexa pronounces it as ph.
+// An empty alphabet defaults to IPA. The text is always kept as the element's
+// content so Alexa falls back to reading it if ph is not understood. An empty
+// ph is recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendPhoneme(text, alphabet, ph string) *SSMLTextBuilder {
+
+	if ph == "" {
+		return builder.fail(errors.New("Phoneme ph must not be empty."))
+	}
+
+	if alphabet == "" {
+		alphabet = PhonemeIPA
+	}
+
+	builder.write(fmt.Sprintf("<phoneme alphabet=\"%s\" ph=\"%s\">%s</phoneme>", xmlEscaper.Replace(alphabet), xmlEscaper.Replace(ph), builder.escape(text)))
 
 	return builder
 }
 
+// AppendProsody changes the rate, pitch and volume of text. Each value can be
+// a named level such as RateSlow or a relative value such as "80%", "+2st" or
+// "+2dB". Empty values are left out. All values being empty, or relative
+// values outside what Alexa supports, are recorded as an error, see Err.
 func (builder *SSMLTextBuilder) AppendProsody(text, rate, pitch, volume string) *SSMLTextBuilder {
+	return builder.AppendProsodyOpts(text, ProsodyOptions{Rate: rate, Pitch: pitch, Volume: volume})
+}
+
+// AppendProsodyOpts is like AppendProsody but takes the relative values as
+// numbers, so they do not have to be formatted by hand. Giving both a named
+// and a relative value for the same attribute is recorded as an error, see
+// Err.
+func (builder *SSMLTextBuilder) AppendProsodyOpts(text string, opts ProsodyOptions) *SSMLTextBuilder {
+
+	attrs, err := prosodyAttributes(opts)
+	if err != nil {
+		return builder.fail(err)
+	}
+
+	builder.write(fmt.Sprintf("<prosody%s>%s</prosody>", attrs, builder.escape(text)))
+
+	return builder
+}
 
-	builder.buffer.WriteString(fmt.Sprintf("<prosody rate=\"%s\" pitch=\"%s\" volume=\"%s\">%s</prosody>", rate, pitch, volume, text))
+// AppendProsodyContent is like AppendProsodyOpts but builds the content with
+// fn, so it can contain other elements such as emphasis or breaks.
+func (builder *SSMLTextBuilder) AppendProsodyContent(opts ProsodyOptions, fn func(*SSMLTextBuilder)) *SSMLTextBuilder {
+
+	attrs, err := prosodyAttributes(opts)
+	if err != nil {
+		return builder.fail(err)
+	}
+
+	return builder.appendContent(fmt.Sprintf("<prosody%s>", attrs), "</prosody>", fn)
+}
+
+// AppendProsodyDefault speaks text at the medium rate, pitch and volume, e.g.
+// to reset the prosody inside content that changes it.
+func (builder *SSMLTextBuilder) AppendProsodyDefault(text string) *SSMLTextBuilder {
+	return builder.AppendProsody(text, RateMedium, PitchMedium, VolumeMedium)
+}
+
+// AppendProsodyDuration stretches or compresses the speech of text to last
+// roughly duration. Alexa does not allow a duration together with a rate, so
+// this takes no other prosody values, and Validate rejects a prosody element
+// with both. A duration that is not positive is recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendProsodyDuration(text string, duration time.Duration) *SSMLTextBuilder {
+
+	if duration <= 0 {
+		return builder.fail(errors.New("Prosody duration must be positive."))
+	}
+
+	// Round up like AppendBreak, so a very short duration does not become 0ms.
+	builder.write(fmt.Sprintf("<prosody duration=\"%dms\">%s</prosody>", (duration+time.Millisecond-1)/time.Millisecond, builder.escape(text)))
 
 	return builder
 }
 
 func (builder *SSMLTextBuilder) AppendSentence(text string) *SSMLTextBuilder {
 
-	builder.buffer.WriteString(fmt.Sprintf("<s>%s</s>", text))
+	builder.write("<s>", builder.escape(text), "</s>")
+
+	return builder
+}
+
+// AppendRaw appends ssml exactly as given, without escaping. The caller must
+// make sure it is well-formed SSML, e.g. a fragment from another builder.
+// Audio in ssml is not counted towards MaxAudioCount; use AppendSSML for
+// fragments that may contain audio.
+func (builder *SSMLTextBuilder) AppendRaw(ssml string) *SSMLTextBuilder {
+	return builder.write(ssml)
+}
+
+// AppendRepeatedAudio plays the MP3 at src count times in a row. A count
+// outside 1 to 10 is recorded as an error, as is a src AppendAudio rejects.
+func (builder *SSMLTextBuilder) AppendRepeatedAudio(src string, count int) *SSMLTextBuilder {
+
+	// A zero RepeatCount means unset to AppendAudioWithOptions, so it has to be
+	// rejected here.
+	if count < 1 {
+		return builder.fail(fmt.Errorf("Audio repeat count %d must be between 1 and %d.", count, maxRepeatCount))
+	}
+
+	return builder.AppendAudioWithOptions(src, AudioOptions{RepeatCount: count})
+}
+
+// AppendSSML appends an SSML fragment from another source, e.g. another skill.
+// A surrounding speak element is removed. A fragment that is not well-formed,
+// contains a speak element, uses elements Alexa does not support or would take
+// the builder over MaxAudioCount audio elements is recorded as an error, see
+// Err.
+func (builder *SSMLTextBuilder) AppendSSML(fragment string) *SSMLTextBuilder {
+
+	fragment = strings.TrimSpace(fragment)
+	if match := speakDocument.FindStringSubmatch(fragment); match != nil {
+		fragment = match[2]
+	}
+
+	if err := validateSSML("<speak>" + fragment + "</speak>"); err != nil {
+		return builder.fail(err)
+	}
+
+	audio := 0
+	for _, match := range startTag.FindAllStringSubmatch(fragment, -1) {
+		if match[1] == "audio" {
+			audio++
+		}
+	}
+
+	if builder.audioCount+audio > MaxAudioCount {
+		return builder.fail(fmt.Errorf("A response can contain at most %d audio files.", MaxAudioCount))
+	}
+
+	builder.write(fragment)
+
+	if builder.err == nil {
+		builder.audioCount += audio
+	}
+
+	return builder
+}
+
+// AppendSayAs wraps text in a say-as element telling Alexa how to interpret it.
+func (builder *SSMLTextBuilder) AppendSayAs(text, interpretAs string) *SSMLTextBuilder {
+
+	builder.write(fmt.Sprintf("<say-as interpret-as=\"%s\">%s</say-as>", xmlEscaper.Replace(interpretAs), builder.escape(text)))
+
+	return builder
+}
+
+// AppendSayAsDate wraps text in a say-as date element using the given format.
+// An empty format is recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendSayAsDate(text, format string) *SSMLTextBuilder {
+
+	if format == "" {
+		return builder.fail(errors.New("Say-as date format must not be empty."))
+	}
+
+	builder.write(fmt.Sprintf("<say-as interpret-as=\"date\" format=\"%s\">%s</say-as>", xmlEscaper.Replace(format), builder.escape(text)))
+
+	return builder
+}
+
+// AppendSpellOut reads text letter by letter using say-as spell-out. It reads
+// letters and digits like AppendCharacters but can treat punctuation
+// differently, so pick whichever sounds right for the content.
+func (builder *SSMLTextBuilder) AppendSpellOut(text string) *SSMLTextBuilder {
+	return builder.AppendSayAs(text, SayAsSpellOut)
+}
+
+// AppendSentences splits text into sentences at ".", "!" and "?" and wraps
+// each one in a sentence element. Common abbreviations such as "Dr." do not
+// end a sentence.
+func (builder *SSMLTextBuilder) AppendSentences(text string) *SSMLTextBuilder {
+
+	for _, sentence := range splitSentences(text) {
+		builder.AppendSentence(sentence)
+	}
 
 	return builder
 }
 
+// AppendSubstitution has Alexa say alias in place of text. An empty alias is
+// recorded as an error, see Err.
 func (builder *SSMLTextBuilder) AppendSubstitution(text, alias string) *SSMLTextBuilder {
 
-	builder.buffer.WriteString(fmt.Sprintf("<sub alias=\"%s\">%s</sub>", alias, text))
+	if alias == "" {
+		return builder.fail(errors.New("Substitution alias must not be empty."))
+	}
+
+	builder.write("<sub alias=\"", xmlEscaper.Replace(alias), "\">", builder.escape(text), "</sub>")
+
+	return builder
+}
+
+// AppendTelephone reads text as a phone number, e.g. "1-800-555-0199".
+func (builder *SSMLTextBuilder) AppendTelephone(text string) *SSMLTextBuilder {
+	return builder.AppendSayAs(text, SayAsTelephone)
+}
+
+// AppendTime reads text as a duration written in minutes and seconds, e.g.
+// 1'21".
+func (builder *SSMLTextBuilder) AppendTime(text string) *SSMLTextBuilder {
+	return builder.AppendSayAs(text, SayAsTime)
+}
+
+// AppendUnit reads text as a measurement, e.g. "10 ft" as "ten feet".
+func (builder *SSMLTextBuilder) AppendUnit(text string) *SSMLTextBuilder {
+	return builder.AppendSayAs(text, SayAsUnit)
+}
+
+// AppendVocalTractLength has text spoken with a simulated vocal tract of the
+// given length, as a percentage of the voice's own. Percentages outside
+// 50-200 are recorded as an error, see Err.
+func (builder *SSMLTextBuilder) AppendVocalTractLength(text string, percent int) *SSMLTextBuilder {
+
+	if percent < minVocalTractLength || percent > maxVocalTractLength {
+		return builder.fail(fmt.Errorf("Vocal tract length %d%% must be between %d%% and %d%%.", percent, minVocalTractLength, maxVocalTractLength))
+	}
+
+	builder.write(fmt.Sprintf("<amazon:effect vocal-tract-length=\"%d%%\">%s</amazon:effect>", percent, builder.escape(text)))
+
+	return builder
+}
+
+// AppendVoiceContent is like AppendVoice but builds the content with fn, so it
+// can contain other elements such as prosody.
+func (builder *SSMLTextBuilder) AppendVoiceContent(name string, fn func(*SSMLTextBuilder)) *SSMLTextBuilder {
+
+	if builder.strict && !ValidVoice(name) {
+		return builder.fail(fmt.Errorf("Unknown voice %q.", name))
+	}
+
+	return builder.appendContent(fmt.Sprintf("<voice name=\"%s\">", xmlEscaper.Replace(name)), "</voice>", fn)
+}
+
+// AppendVoice has text spoken by the named Amazon Polly voice. A voice that is
+// not one of the Voice* constants is recorded as an error, see Err, when the
+// builder was created with WithStrictTags.
+func (builder *SSMLTextBuilder) AppendVoice(text, name string) *SSMLTextBuilder {
+
+	if builder.strict && !ValidVoice(name) {
+		return builder.fail(fmt.Errorf("Unknown voice %q.", name))
+	}
+
+	builder.write(fmt.Sprintf("<voice name=\"%s\">%s</voice>", xmlEscaper.Replace(name), builder.escape(text)))
+
+	return builder
+}
+
+// AppendWhisper has text whispered.
+func (builder *SSMLTextBuilder) AppendWhisper(text string) *SSMLTextBuilder {
+	return builder.AppendAmazonEffect(text, EffectWhispered)
+}
+
+// AppendWithBreakAfter appends text as plain speech followed by a pause of
+// the given duration. A zero duration, or one AppendBreak rejects, is recorded
+// as an error, see Err, and text is not appended.
+func (builder *SSMLTextBuilder) AppendWithBreakAfter(text string, duration time.Duration) *SSMLTextBuilder {
+
+	if duration == 0 {
+		return builder.fail(fmt.Errorf("Break after %q needs a duration.", text))
+	}
+
+	if err := validateBreakDuration(duration); err != nil {
+		return builder.fail(err)
+	}
+
+	return builder.AppendPlainSpeech(text).AppendBreakTime(duration)
+}
+
+// AppendWord speaks text with the given word role, e.g. WordRoleVerbPast to
+// read "read" in the past tense.
+func (builder *SSMLTextBuilder) AppendWord(text, role string) *SSMLTextBuilder {
+
+	builder.write(fmt.Sprintf("<w role=\"%s\">%s</w>", xmlEscaper.Replace(role), builder.escape(text)))
 
 	return builder
 }
 
+// Reader returns a reader over the Build output that does not copy the
+// builder's content into a new string first. The builder must not be modified
+// while the reader is in use.
+func (builder *SSMLTextBuilder) Reader() io.Reader {
+	return io.MultiReader(
+		strings.NewReader(builder.speakTag()),
+		bytes.NewReader(builder.buffer.Bytes()),
+		strings.NewReader("</speak>"),
+	)
+}
+
+// Write appends p as plain speech, escaped like AppendPlainSpeech, so a builder
+// can be the target of io.Writer APIs such as text/template's Execute. Writers
+// split their output into arbitrary chunks, so WithAutoSpace does not apply.
+func (builder *SSMLTextBuilder) Write(p []byte) (int, error) {
+	if builder.err != nil {
+		return 0, builder.err
+	}
+
+	builder.write(builder.escape(string(p)))
+
+	return len(p), nil
+}
+
 func (builder *SSMLTextBuilder) Build() string {
-	return fmt.Sprintf("<speak>%s</speak>", builder.buffer.String())
+	return string(builder.Bytes())
+}
+
+// Bytes returns the Build output as a byte slice. The slice is a new copy, so
+// it is safe to keep after further appends.
+func (builder *SSMLTextBuilder) Bytes() []byte {
+	open := builder.speakTag()
+	out := make([]byte, 0, len(open)+builder.buffer.Len()+len("</speak>"))
+	out = append(out, open...)
+	out = append(out, builder.buffer.Bytes()...)
+
+	return append(out, "</speak>"...)
+}
+
+// BuildIndented returns the Build output with one element or text run per line,
+// indented by nesting depth. It is meant for reading while debugging and
+// should not be sent to Alexa. If the output is not well-formed it is returned
+// as is.
+func (builder *SSMLTextBuilder) BuildIndented() string {
+	var out bytes.Buffer
+	ssml := builder.Build()
+	decoder := xml.NewDecoder(strings.NewReader(ssml))
+	var open []string
+	selfClosed := false
+
+	// RawToken keeps prefixes such as xml:lang as written but does not match
+	// end elements to start elements, so that is done with open.
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF && len(open) == 0 {
+			return out.String()
+		}
+		if err != nil {
+			return ssml
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			out.WriteString(strings.Repeat("  ", len(open)) + "<" + tagName(t.Name))
+			for _, attr := range t.Attr {
+				out.WriteString(fmt.Sprintf(" %s=\"%s\"", tagName(attr.Name), xmlEscaper.Replace(attr.Value)))
+			}
+
+			// The decoder reports <break/> as a start and an end element, so
+			// look at the input to keep it self-closing.
+			selfClosed = strings.HasSuffix(ssml[:decoder.InputOffset()], "/>")
+			if selfClosed {
+				out.WriteString("/>\n")
+				break
+			}
+
+			out.WriteString(">\n")
+			open = append(open, tagName(t.Name))
+		case xml.EndElement:
+			if selfClosed {
+				selfClosed = false
+				break
+			}
+
+			if len(open) == 0 || open[len(open)-1] != tagName(t.Name) {
+				return ssml
+			}
+
+			open = open[:len(open)-1]
+			out.WriteString(strings.Repeat("  ", len(open)) + "</" + tagName(t.Name) + ">\n")
+		case xml.CharData:
+			if text := strings.TrimSpace(string(t)); text != "" {
+				out.WriteString(strings.Repeat("  ", len(open)) + xmlEscaper.Replace(text) + "\n")
+			}
+		}
+	}
+}
+
+// MustBuild is like Build but panics if an Append method has failed.
+func (builder *SSMLTextBuilder) MustBuild() string {
+	return builder.Must().Build()
+}
+
+// BuildWithLimit is like Build but returns an error if an Append method failed
+// or the output is longer than max characters. A max of zero or less uses the
+// WithMaxLen option, or MaxOutputLength if that was not given.
+func (builder *SSMLTextBuilder) BuildWithLimit(max int) (string, error) {
+	if builder.err != nil {
+		return "", builder.err
+	}
+
+	if max <= 0 {
+		max = builder.maxLen
+	}
+
+	if max <= 0 {
+		max = MaxOutputLength
+	}
+
+	ssml := builder.Build()
+	if length := utf8.RuneCountInString(ssml); length > max {
+		return "", fmt.Errorf("SSML output is %d characters, over the %d character limit.", length, max)
+	}
+
+	return ssml, nil
+}
+
+// BuildChunks splits the content into speak documents of at most max
+// characters each, for playing long content in several responses. Content is
+// only split between top-level elements and sentences, never inside an
+// element. A max of zero or less is treated as in BuildWithLimit. It returns
+// an error if an Append method failed or a single sentence or element does
+// not fit in max.
+func (builder *SSMLTextBuilder) BuildChunks(max int) ([]string, error) {
+	if builder.err != nil {
+		return nil, builder.err
+	}
+
+	if max <= 0 {
+		max = builder.maxLen
+	}
+
+	if max <= 0 {
+		max = MaxOutputLength
+	}
+
+	content := builder.buffer.String()
+	open, close := builder.speakTag(), "</speak>"
+	overhead := utf8.RuneCountInString(open) + len(close)
+
+	var chunks []string
+	start, last := 0, 0
+
+	for _, boundary := range chunkBoundaries(content) {
+		if overhead+utf8.RuneCountInString(strings.TrimSpace(content[start:boundary])) > max {
+			if last == start {
+				return nil, fmt.Errorf("SSML content at offset %d does not fit in %d characters.", start, max)
+			}
+
+			chunks = append(chunks, open+strings.TrimSpace(content[start:last])+close)
+			start = last
+
+			if overhead+utf8.RuneCountInString(strings.TrimSpace(content[start:boundary])) > max {
+				return nil, fmt.Errorf("SSML content at offset %d does not fit in %d characters.", start, max)
+			}
+		}
+
+		last = boundary
+	}
+
+	if start < len(content) || len(chunks) == 0 {
+		chunks = append(chunks, open+strings.TrimSpace(content[start:])+close)
+	}
+
+	return chunks, nil
+}
+
+// Validate checks that the Build output is a single well-formed speak element,
+// only uses elements Alexa supports and does not nest them in ways Alexa
+// forbids, such as audio inside audio or a paragraph inside a sentence. It
+// also returns any error recorded by an Append method.
+func (builder *SSMLTextBuilder) Validate() error {
+	if builder.err != nil {
+		return builder.err
+	}
+
+	return validateSSML(builder.Build())
+}
+
+// Counts returns how many elements of each kind the builder holds, keyed by
+// tag name, e.g. "audio" or "amazon:effect". The speak wrapper is not counted.
+func (builder *SSMLTextBuilder) Counts() map[string]int {
+	counts := map[string]int{}
+
+	for _, match := range startTag.FindAllStringSubmatch(builder.buffer.String(), -1) {
+		counts[match[1]]++
+	}
+
+	return counts
+}
+
+// EstimateDuration gives a rough idea of how long Alexa will talk for, from
+// the number of spoken words and the explicit break times. Audio clips and
+// prosody changes are not taken into account.
+func (builder *SSMLTextBuilder) EstimateDuration() time.Duration {
+	wpm := builder.wordsPerMinute
+	if wpm <= 0 {
+		wpm = DefaultWordsPerMinute
+	}
+
+	words := len(strings.Fields(builder.SpokenText()))
+	estimate := time.Duration(words) * time.Minute / time.Duration(wpm)
+
+	for _, match := range breakTime.FindAllStringSubmatch(builder.buffer.String(), -1) {
+		value, _ := strconv.ParseFloat(match[1], 64)
+		unit := time.Millisecond
+		if match[2] == "s" {
+			unit = time.Second
+		}
+
+		estimate += time.Duration(value * float64(unit))
+	}
+
+	return estimate
+}
+
+// MarshalJSON encodes the builder as an SSML output speech object, so it can be
+// embedded directly in a response. It fails if an Append method failed.
+func (builder *SSMLTextBuilder) MarshalJSON() ([]byte, error) {
+	if builder.err != nil {
+		return nil, builder.err
+	}
+
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		SSML string `json:"ssml"`
+	}{
+		Type: "SSML",
+		SSML: builder.Build(),
+	})
+}
+
+// MarshalText returns the Build output, so a builder can be used wherever an
+// encoding.TextMarshaler is accepted. It fails if an Append method failed.
+func (builder *SSMLTextBuilder) MarshalText() ([]byte, error) {
+	if builder.err != nil {
+		return nil, builder.err
+	}
+
+	return builder.Bytes(), nil
+}
+
+// Inner returns the builder's content without the speak wrapper, e.g. for
+// composing it into another document.
+func (builder *SSMLTextBuilder) Inner() string {
+	return builder.buffer.String()
+}
+
+// IsEmpty reports whether nothing has been appended, e.g. to fall back to a
+// default prompt.
+func (builder *SSMLTextBuilder) IsEmpty() bool {
+	return builder.buffer.Len() == 0
+}
+
+// Len returns the number of characters in the Build output, including the
+// speak wrapper, which is what Alexa's output size limit is measured against.
+func (builder *SSMLTextBuilder) Len() int {
+	return utf8.RuneCountInString(builder.Build())
+}
+
+// PlainText returns the content with all markup removed, e.g. for the text of
+// a card shown alongside the speech. Substitutions keep their written text.
+func (builder *SSMLTextBuilder) PlainText() string {
+	return stripTags(builder.buffer.String())
+}
+
+// SpokenText is like PlainText but replaces substitutions with their alias,
+// which is what Alexa actually says.
+func (builder *SSMLTextBuilder) SpokenText() string {
+	return stripTags(subElement.ReplaceAllString(builder.buffer.String(), "$1"))
+}
+
+// TextLen returns the number of spoken characters, ignoring all markup.
+func (builder *SSMLTextBuilder) TextLen() int {
+	return utf8.RuneCountInString(stripTags(builder.buffer.String()))
+}
+
+// Type returns the output speech type of o, "SSML" or "PlainText".
+func (o Output) Type() string {
+	if o.Mode == OutputPlainText {
+		return "PlainText"
+	}
+
+	return "SSML"
+}
+
+// String renders the builder's content in o's mode.
+func (o Output) String() string {
+	if o.Mode == OutputPlainText {
+		return o.Builder.PlainText()
+	}
+
+	return o.Builder.Build()
+}
+
+// Payload returns o as an output speech object that can be set as the
+// OutputSpeech of a response. It fails if an Append method failed.
+func (o Output) Payload() (*EchoRespPayload, error) {
+	if err := o.Builder.Err(); err != nil {
+		return nil, err
+	}
+
+	if o.Mode == OutputPlainText {
+		return &EchoRespPayload{Type: o.Type(), Text: o.String()}, nil
+	}
+
+	return &EchoRespPayload{Type: o.Type(), SSML: o.String()}, nil
 }
@@ -0,0 +1,1849 @@
+package skillserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestAppendBreakStrengthOnly(t *testing.T) {
+	got := NewSSMLTextBuilder().AppendBreak("weak", 0).Build()
+
+	if want := `<speak><break strength="weak"/></speak>`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestAppendLang(t *testing.T) {
+	tests := []struct {
+		locale  string
+		want    string
+		wantErr bool
+	}{
+		{"es-ES", `<speak><lang xml:lang="es-ES">hola</lang></speak>`, false},
+		{"en-GB", `<speak><lang xml:lang="en-GB">hola</lang></speak>`, false},
+		{"de-DE", `<speak><lang xml:lang="de-DE">hola</lang></speak>`, false},
+		{"fr-FR", `<speak><lang xml:lang="fr-FR">hola</lang></speak>`, false},
+		{"it-IT", `<speak><lang xml:lang="it-IT">hola</lang></speak>`, false},
+		{"ja-JP", `<speak><lang xml:lang="ja-JP">hola</lang></speak>`, false},
+		{"xx-XX", `<speak></speak>`, true},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendLang("hola", test.locale)
+
+		if got := builder.Build(); got != test.want {
+			t.Errorf("AppendLang(%q) = %s, want %s", test.locale, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendLang(%q) error = %v, want error %v", test.locale, err, test.wantErr)
+		}
+	}
+}
+
+func TestAppendBreak(t *testing.T) {
+	tests := []struct {
+		strength string
+		duration time.Duration
+		want     string
+	}{
+		{BreakMedium, time.Second, `<speak><break strength="medium" time="1000ms"/></speak>`},
+		{"", 500 * time.Millisecond, `<speak><break time="500ms"/></speak>`},
+		{BreakStrong, 0, `<speak><break strength="strong"/></speak>`},
+		{"", 0, `<speak><break/></speak>`},
+		{"", time.Microsecond, `<speak><break time="1ms"/></speak>`},
+		{"", 1500 * time.Microsecond, `<speak><break time="2ms"/></speak>`},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendBreak(test.strength, test.duration)
+
+		if got := builder.Build(); got != test.want {
+			t.Errorf("AppendBreak(%q, %s) = %s, want %s", test.strength, test.duration, got, test.want)
+		}
+
+		if err := builder.Err(); err != nil {
+			t.Errorf("AppendBreak(%q, %s) error = %v", test.strength, test.duration, err)
+		}
+	}
+}
+
+func TestAppendBreakDurationLimit(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		wantErr  bool
+	}{
+		{10 * time.Second, false},
+		{10001 * time.Millisecond, true},
+		{-time.Second, true},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendBreakTime(test.duration)
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendBreakTime(%s) error = %v, want error %v", test.duration, err, test.wantErr)
+		}
+
+		if test.wantErr && builder.Build() != "<speak></speak>" {
+			t.Errorf("AppendBreakTime(%s) wrote %s despite the error", test.duration, builder.Build())
+		}
+	}
+}
+
+func TestErrorLatching(t *testing.T) {
+	builder := NewSSMLTextBuilder().
+		AppendPlainSpeech("Before").
+		AppendAudio("http://example.com/clip.mp3").
+		AppendSentence("after").
+		AppendBreakTime(-time.Second).
+		AppendParagraph("ignored")
+
+	err := builder.Err()
+	if err == nil {
+		t.Fatal("Err() = nil, want the AppendAudio error")
+	}
+
+	if !strings.Contains(err.Error(), "http://example.com/clip.mp3") {
+		t.Errorf("Err() = %v, want the AppendAudio error, not a later one", err)
+	}
+
+	if got, want := builder.Build(), "<speak>Before</speak>"; got != want {
+		t.Errorf("Build() = %s, want %s", got, want)
+	}
+}
+
+func TestAppendAudioWithOptions(t *testing.T) {
+	const src = "https://example.com/clip.mp3"
+
+	tests := []struct {
+		opts    AudioOptions
+		want    string
+		wantErr bool
+	}{
+		{AudioOptions{}, `<audio src="` + src + `"/>`, false},
+		{AudioOptions{ClipBegin: time.Second}, `<audio src="` + src + `" clipBegin="1000ms"/>`, false},
+		{AudioOptions{ClipEnd: 2 * time.Second}, `<audio src="` + src + `" clipEnd="2000ms"/>`, false},
+		{AudioOptions{RepeatCount: 3}, `<audio src="` + src + `" repeatCount="3"/>`, false},
+		{AudioOptions{SoundLevel: -3}, `<audio src="` + src + `" soundLevel="-3dB"/>`, false},
+		{
+			AudioOptions{ClipBegin: time.Second, ClipEnd: 2 * time.Second, RepeatCount: 2, SoundLevel: 6},
+			`<audio src="` + src + `" clipBegin="1000ms" clipEnd="2000ms" repeatCount="2" soundLevel="+6dB"/>`,
+			false,
+		},
+		{AudioOptions{ClipBegin: -time.Second}, "", true},
+		{AudioOptions{ClipEnd: -time.Second}, "", true},
+		{AudioOptions{ClipBegin: 2 * time.Second, ClipEnd: time.Second}, "", true},
+		{AudioOptions{RepeatCount: 11}, "", true},
+		{AudioOptions{RepeatCount: -1}, "", true},
+		{AudioOptions{SoundLevel: 7}, "", true},
+		{AudioOptions{SoundLevel: -7}, "", true},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendAudioWithOptions(src, test.opts)
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("AppendAudioWithOptions(%+v) = %s, want %s", test.opts, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendAudioWithOptions(%+v) error = %v, want error %v", test.opts, err, test.wantErr)
+		}
+	}
+}
+
+func TestAppendAudioFallback(t *testing.T) {
+	const src = "https://example.com/clip.mp3"
+
+	plain := NewSSMLTextBuilder().AppendAudio(src)
+	if got, want := plain.Inner(), `<audio src="`+src+`"/>`; got != want {
+		t.Errorf("without fallback = %s, want %s", got, want)
+	}
+
+	fallback := NewSSMLTextBuilder().AppendPlainSpeech("The clip is missing.")
+	withFallback := NewSSMLTextBuilder().AppendAudioWithOptions(src, AudioOptions{Fallback: fallback})
+	if got, want := withFallback.Inner(), `<audio src="`+src+`">The clip is missing.</audio>`; got != want {
+		t.Errorf("with fallback = %s, want %s", got, want)
+	}
+
+	nested := NewSSMLTextBuilder().AppendAudio(src)
+	rejected := NewSSMLTextBuilder().AppendAudioWithOptions(src, AudioOptions{Fallback: nested})
+	if rejected.Err() == nil {
+		t.Errorf("audio fallback = %s, want an error", rejected.Build())
+	}
+}
+
+func TestParseSSMLRoundTrip(t *testing.T) {
+	original := NewSSMLTextBuilder(WithSpeakLang("en-GB")).
+		AppendPlainSpeech("Tom & Jerry").
+		AppendBreakTime(time.Second).
+		AppendEmphasis("now", EmphasisStrong).
+		Build()
+
+	builder, err := ParseSSML(original)
+	if err != nil {
+		t.Fatalf("ParseSSML(%s) error = %v", original, err)
+	}
+
+	if got := builder.Build(); got != original {
+		t.Errorf("ParseSSML(%s).Build() = %s", original, got)
+	}
+
+	if _, err := ParseSSML("no speak wrapper"); err == nil {
+		t.Error("ParseSSML without a speak wrapper: error = nil")
+	}
+
+	if _, err := ParseSSML("<speak>a</speak><speak>b</speak>"); err == nil {
+		t.Error("ParseSSML with two speak elements: error = nil")
+	}
+
+	if _, err := ParseSSML("<speak><s>unclosed</speak>"); err == nil {
+		t.Error("ParseSSML with an unclosed element: error = nil")
+	}
+}
+
+func TestParseSSMLCountsAudio(t *testing.T) {
+	audio := NewSSMLTextBuilder()
+	for i := 0; i < MaxAudioCount; i++ {
+		audio.AppendAudio("https://example.com/clip.mp3")
+	}
+
+	builder, err := ParseSSML(audio.Build())
+	if err != nil {
+		t.Fatalf("ParseSSML error = %v", err)
+	}
+
+	if got := builder.AudioCount(); got != MaxAudioCount {
+		t.Errorf("AudioCount() = %d, want %d", got, MaxAudioCount)
+	}
+
+	if builder.AppendAudio("https://example.com/clip.mp3").Err() == nil {
+		t.Error("appending a sixth audio after ParseSSML: error = nil")
+	}
+
+	tooMany := audio.Inner() + `<audio src="https://example.com/clip.mp3"/>`
+	if _, err := ParseSSML("<speak>" + tooMany + "</speak>"); err == nil {
+		t.Error("ParseSSML with six audio elements: error = nil")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{"valid", `<p><s>One.</s><s>Two.</s></p>`, false},
+		{"unbalanced", `<p><s>One.</p>`, true},
+		{"unsupported tag", `<blink>Hi</blink>`, true},
+		{"second root", `</speak><speak>b`, true},
+		{"trailing text", `</speak>trailing<speak>`, true},
+	}
+
+	for _, test := range tests {
+		err := NewSSMLTextBuilder().AppendRaw(test.raw).Validate()
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: Validate() = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SSMLTextBuilder
+		want    string
+	}{
+		{"sentences", NewSSMLTextBuilder().AppendSentence("One").AppendSentence("Two"), "One Two"},
+		{"break", NewSSMLTextBuilder().AppendPlainSpeech("Hi").AppendBreakStrength(BreakWeak).AppendPlainSpeech("there"), "Hi there"},
+		{"prosody", NewSSMLTextBuilder().AppendPlainSpeech("Go ").AppendProsody("slowly", RateSlow, "", "").AppendPlainSpeech("."), "Go slowly."},
+		{"emphasis", NewSSMLTextBuilder().AppendEmphasis("Really", EmphasisStrong).AppendPlainSpeech(", yes"), "Really, yes"},
+		{"substitution", NewSSMLTextBuilder().AppendPlainSpeech("Made by").AppendSubstitution("Al", "aluminium"), "Made by Al"},
+		{"escaping", NewSSMLTextBuilder().AppendParagraph("Tom & Jerry").AppendParagraph("  spaced   out "), "Tom & Jerry spaced out"},
+	}
+
+	for _, test := range tests {
+		if got := test.builder.PlainText(); got != test.want {
+			t.Errorf("%s: PlainText() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSpokenTextAndWordCounts(t *testing.T) {
+	builder := NewSSMLTextBuilder(WithWPM(60)).
+		AppendSentence("One").
+		AppendSentence("Two").
+		AppendSubstitution("Al", "aluminium")
+
+	if got, want := builder.SpokenText(), "One Two aluminium"; got != want {
+		t.Errorf("SpokenText() = %q, want %q", got, want)
+	}
+
+	if got, want := builder.TextLen(), len("One Two Al"); got != want {
+		t.Errorf("TextLen() = %d, want %d", got, want)
+	}
+
+	if got, want := builder.EstimateDuration(), 3*time.Second; got != want {
+		t.Errorf("EstimateDuration() = %s, want %s", got, want)
+	}
+}
+
+func TestEstimateDuration(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SSMLTextBuilder
+		want    time.Duration
+	}{
+		{"milliseconds", NewSSMLTextBuilder().AppendPlainSpeech("one two three").AppendBreakTime(2 * time.Second), 3200 * time.Millisecond},
+		{"seconds", NewSSMLTextBuilder().AppendSSML(`<speak>one two three <break time="2s"/></speak>`), 3200 * time.Millisecond},
+		{"fractional seconds", NewSSMLTextBuilder().AppendSSML(`<break time="1.5s"/>`), 1500 * time.Millisecond},
+		{"strength only", NewSSMLTextBuilder().AppendBreakStrength(BreakStrong), 0},
+	}
+
+	for _, test := range tests {
+		if err := test.builder.Err(); err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+
+		if got := test.builder.EstimateDuration(); got != test.want {
+			t.Errorf("%s: EstimateDuration() = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestProsodyRanges(t *testing.T) {
+	intp := func(n int) *int { return &n }
+
+	tests := []struct {
+		name    string
+		opts    ProsodyOptions
+		wantErr bool
+	}{
+		{"volume at minimum", ProsodyOptions{Volume: "-6dB"}, false},
+		{"volume below minimum", ProsodyOptions{Volume: "-6.01dB"}, true},
+		{"volume at maximum", ProsodyOptions{Volume: "+4.08dB"}, false},
+		{"volume above maximum", ProsodyOptions{VolumeDB: intp(5)}, true},
+		{"rate positive", ProsodyOptions{RatePercent: intp(1)}, false},
+		{"rate zero", ProsodyOptions{RatePercent: intp(0)}, true},
+		{"pitch at minimum", ProsodyOptions{Pitch: "-33.3%"}, false},
+		{"pitch below minimum", ProsodyOptions{PitchPercent: intp(-34)}, true},
+		{"pitch at maximum", ProsodyOptions{PitchPercent: intp(50)}, false},
+		{"pitch above maximum", ProsodyOptions{PitchPercent: intp(51)}, true},
+	}
+
+	for _, test := range tests {
+		err := NewSSMLTextBuilder().AppendProsodyOpts("text", test.opts).Err()
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestAudioCountLimit(t *testing.T) {
+	builder := NewSSMLTextBuilder(WithRequireMP3(true))
+
+	for i := 0; i < MaxAudioCount; i++ {
+		builder.AppendAudio("https://example.com/clip.mp3")
+	}
+
+	if err := builder.Err(); err != nil {
+		t.Fatalf("%d audio files: error = %v", MaxAudioCount, err)
+	}
+
+	if got := builder.AudioCount(); got != MaxAudioCount {
+		t.Errorf("AudioCount() = %d, want %d", got, MaxAudioCount)
+	}
+
+	if builder.AppendAudio("https://example.com/clip.mp3").Err() == nil {
+		t.Errorf("%d audio files: error = nil", MaxAudioCount+1)
+	}
+
+	if got := builder.AudioCount(); got != MaxAudioCount {
+		t.Errorf("AudioCount() after the rejected audio = %d, want %d", got, MaxAudioCount)
+	}
+
+	if NewSSMLTextBuilder(WithRequireMP3(true)).AppendAudio("https://example.com/clip.wav").Err() == nil {
+		t.Error("WAV file with WithRequireMP3: error = nil")
+	}
+}
+
+func TestPutSSMLTextBuilderResets(t *testing.T) {
+	builder := GetSSMLTextBuilder()
+	builder.AppendAudio("http://not-https")
+	PutSSMLTextBuilder(builder)
+
+	builder = GetSSMLTextBuilder()
+	defer PutSSMLTextBuilder(builder)
+
+	if !builder.IsEmpty() || builder.Err() != nil {
+		t.Errorf("pooled builder = %s, %v, want an empty builder", builder.Build(), builder.Err())
+	}
+}
+
+func BenchmarkNewSSMLTextBuilder(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		NewSSMLTextBuilder().AppendSentence("Welcome back.").AppendBreakTime(time.Second).Build()
+	}
+}
+
+func BenchmarkPooledSSMLTextBuilder(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		builder := GetSSMLTextBuilder()
+		builder.AppendSentence("Welcome back.").AppendBreakTime(time.Second).Build()
+		PutSSMLTextBuilder(builder)
+	}
+}
+
+func TestWithCapacityIgnoresNegative(t *testing.T) {
+	builder := NewSSMLTextBuilder(WithCapacity(-1)).AppendPlainSpeech("Hi")
+
+	if got, want := builder.Build(), "<speak>Hi</speak>"; got != want {
+		t.Errorf("Build() = %s, want %s", got, want)
+	}
+}
+
+func benchmarkLongResponse(b *testing.B, opts ...SSMLOption) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		builder := NewSSMLTextBuilder(opts...)
+		for builder.buffer.Len() < MaxOutputLength-100 {
+			builder.AppendSentence("This sentence is part of a long-form response.")
+		}
+	}
+}
+
+func BenchmarkLongResponse(b *testing.B) {
+	benchmarkLongResponse(b)
+}
+
+func BenchmarkLongResponseWithCapacity(b *testing.B) {
+	benchmarkLongResponse(b, WithCapacity(MaxOutputLength))
+}
+
+func TestAppendDate(t *testing.T) {
+	date := time.Date(2024, time.November, 23, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		locale  string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{"", DateFormatMDY, `<say-as interpret-as="date" format="mdy">11-23-2024</say-as>`, false},
+		{"", DateFormatYMD, `<say-as interpret-as="date" format="ymd">2024-11-23</say-as>`, false},
+		{"", DateFormatMY, `<say-as interpret-as="date" format="my">11-2024</say-as>`, false},
+		{"en-US", "", `<say-as interpret-as="date" format="mdy">11-23-2024</say-as>`, false},
+		{"en-GB", "", `<say-as interpret-as="date" format="dmy">23-11-2024</say-as>`, false},
+		{"ja-JP", "", `<say-as interpret-as="date" format="ymd">2024-11-23</say-as>`, false},
+		{"", "yyy", "", true},
+		{"", "dd", "", true},
+		{"", "", "", true},
+	}
+
+	for _, test := range tests {
+		var opts []SSMLOption
+		if test.locale != "" {
+			opts = append(opts, WithLocale(test.locale))
+		}
+
+		builder := NewSSMLTextBuilder(opts...).AppendDate(date, test.format)
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("%s AppendDate(%q) = %s, want %s", test.locale, test.format, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("%s AppendDate(%q) error = %v, want error %v", test.locale, test.format, err, test.wantErr)
+		}
+	}
+}
+
+func TestAppendDurationSpoken(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     string
+		wantErr  bool
+	}{
+		{81 * time.Second, `<say-as interpret-as="time" format="hms12">1'21&quot;</say-as>`, false},
+		{1500 * time.Millisecond, `<say-as interpret-as="time" format="hms12">0'2&quot;</say-as>`, false},
+		{2 * time.Hour, `<say-as interpret-as="time" format="hms12">120'0&quot;</say-as>`, false},
+		{time.Hour + 5*time.Minute + 9*time.Second, `<say-as interpret-as="time" format="hms12">65'9&quot;</say-as>`, false},
+		{13 * time.Hour, `<say-as interpret-as="time" format="hms12">780'0&quot;</say-as>`, false},
+		{-1500 * time.Millisecond, "", true},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendDurationSpoken(test.duration)
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("AppendDurationSpoken(%s) = %s, want %s", test.duration, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendDurationSpoken(%s) error = %v, want error %v", test.duration, err, test.wantErr)
+		}
+	}
+}
+
+func TestAppendSubstitution(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendSubstitution("Al", "")
+	if builder.Err() == nil {
+		t.Errorf("empty alias = %s, want an error", builder.Build())
+	}
+
+	builder = NewSSMLTextBuilder().AppendSubstitution("12\"", `12 "inch"`)
+	if got, want := builder.Inner(), `<sub alias="12 &quot;inch&quot;">12&quot;</sub>`; got != want {
+		t.Errorf("quoted alias = %s, want %s", got, want)
+	}
+}
+
+func TestAppendProsodyWithoutValues(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendProsody("text", "", "", "")
+
+	if builder.Err() == nil {
+		t.Errorf("AppendProsody without values = %s, want an error", builder.Build())
+	}
+}
+
+func TestAppendBreakAttributeOrder(t *testing.T) {
+	got := NewSSMLTextBuilder().AppendBreak(BreakXStrong, 2*time.Second).Inner()
+
+	if want := `<break strength="x-strong" time="2000ms"/>`; got != want {
+		t.Errorf("AppendBreak = %s, want %s", got, want)
+	}
+}
+
+func TestAppendEmphasisLevels(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendEmphasis("fine", EmphasisNone)
+	if got, want := builder.Inner(), `<emphasis level="none">fine</emphasis>`; got != want || builder.Err() != nil {
+		t.Errorf("EmphasisNone = %s, %v, want %s", got, builder.Err(), want)
+	}
+
+	if err := NewSSMLTextBuilder().AppendEmphasis("loud", "shouty").Err(); err == nil {
+		t.Error("invalid level: error = nil")
+	}
+
+	if err := NewSSMLTextBuilder(WithCustomEmphasis(true)).AppendEmphasis("loud", "shouty").Err(); err != nil {
+		t.Errorf("invalid level with WithCustomEmphasis: error = %v", err)
+	}
+
+	if ValidEmphasisLevel("shouty") || !ValidEmphasisLevel(EmphasisNone) {
+		t.Error("ValidEmphasisLevel does not match the Emphasis* constants")
+	}
+}
+
+func TestAppendBreakStrictStrength(t *testing.T) {
+	if err := NewSSMLTextBuilder().AppendBreakStrength("custom").Err(); err != nil {
+		t.Errorf("lax mode: error = %v", err)
+	}
+
+	if err := NewSSMLTextBuilder(WithStrictTags(true)).AppendBreakStrength("custom").Err(); err == nil {
+		t.Error("strict mode: error = nil")
+	}
+
+	for _, strength := range []string{BreakNone, BreakXWeak, BreakWeak, BreakMedium, BreakStrong, BreakXStrong} {
+		if err := NewSSMLTextBuilder(WithStrictTags(true)).AppendBreakStrength(strength).Err(); err != nil {
+			t.Errorf("strict mode, %q: error = %v", strength, err)
+		}
+	}
+}
+
+func TestAppendProsodyOptsConflict(t *testing.T) {
+	percent := 80
+	err := NewSSMLTextBuilder().AppendProsodyOpts("text", ProsodyOptions{Rate: RateMedium, RatePercent: &percent}).Err()
+
+	if err == nil || !strings.Contains(err.Error(), "rate") || !strings.Contains(err.Error(), RateMedium) {
+		t.Errorf("named and percent rate: error = %v, want one naming the rate conflict", err)
+	}
+}
+
+func TestAppendProsodySemitones(t *testing.T) {
+	tests := []struct {
+		semitones int
+		want      string
+		wantErr   bool
+	}{
+		{2, `<prosody pitch="+2st">text</prosody>`, false},
+		{-3, `<prosody pitch="-3st">text</prosody>`, false},
+		{7, `<prosody pitch="+7st">text</prosody>`, false},
+		{-7, `<prosody pitch="-7st">text</prosody>`, false},
+		{8, "", true},
+		{-8, "", true},
+	}
+
+	for _, test := range tests {
+		semitones := test.semitones
+		builder := NewSSMLTextBuilder().AppendProsodyOpts("text", ProsodyOptions{PitchSemitones: &semitones})
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("AppendProsodyOpts(%+dst) = %s, want %s", test.semitones, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendProsodyOpts(%+dst) error = %v, want error %v", test.semitones, err, test.wantErr)
+		}
+	}
+
+	semitones, percent := 2, 10
+	if err := NewSSMLTextBuilder().AppendProsodyOpts("text", ProsodyOptions{PitchSemitones: &semitones, PitchPercent: &percent}).Err(); err == nil {
+		t.Error("semitones and percent pitch: error = nil")
+	}
+}
+
+func TestAppendInterjectionLocale(t *testing.T) {
+	RegisterSpeechcons("en-GB", "blimey", "cheerio")
+	defer func() {
+		speechconsMu.Lock()
+		delete(speechcons, "en-GB")
+		speechconsMu.Unlock()
+	}()
+
+	if err := NewSSMLTextBuilder(WithLocale("en-GB")).AppendInterjection("Cheerio", false).Err(); err != nil {
+		t.Errorf("registered en-GB speechcon: error = %v", err)
+	}
+
+	if err := NewSSMLTextBuilder(WithLocale("en-GB")).AppendInterjection("howdy", false).Err(); err == nil {
+		t.Error("en-US-only speechcon under en-GB: error = nil")
+	}
+
+	if err := NewSSMLTextBuilder(WithLocale("en-US")).AppendInterjection("howdy", false).Err(); err != nil {
+		t.Errorf("locale without registered speechcons: error = %v", err)
+	}
+
+	if err := NewSSMLTextBuilder().AppendInterjection("howdy", false).Err(); err != nil {
+		t.Errorf("no locale: error = %v", err)
+	}
+}
+
+func TestAppendInterjectionSpaced(t *testing.T) {
+	const boing = `<say-as interpret-as="interjection">boing</say-as>`
+
+	tests := []struct {
+		name  string
+		build func(*SSMLTextBuilder) *SSMLTextBuilder
+		want  string
+	}{
+		{"unspaced", func(b *SSMLTextBuilder) *SSMLTextBuilder {
+			return b.AppendPlainSpeech("Well").AppendInterjection("boing", false).AppendPlainSpeech("that hurt.")
+		}, "Well" + boing + "that hurt."},
+		{"between words", func(b *SSMLTextBuilder) *SSMLTextBuilder {
+			return b.AppendPlainSpeech("Well").AppendInterjection("boing", true).AppendPlainSpeech("that hurt.")
+		}, "Well, " + boing + ", that hurt."},
+		{"first", func(b *SSMLTextBuilder) *SSMLTextBuilder {
+			return b.AppendInterjection("boing", true).AppendPlainSpeech("that hurt.")
+		}, boing + ", that hurt."},
+		{"after a period", func(b *SSMLTextBuilder) *SSMLTextBuilder {
+			return b.AppendPlainSpeech("Hello.").AppendInterjection("boing", true)
+		}, "Hello." + boing},
+		{"after a space", func(b *SSMLTextBuilder) *SSMLTextBuilder {
+			return b.AppendPlainSpeech("Well ").AppendInterjection("boing", true).AppendPlainSpeech(" that hurt.")
+		}, "Well " + boing + ", that hurt."},
+		{"before punctuation", func(b *SSMLTextBuilder) *SSMLTextBuilder {
+			return b.AppendPlainSpeech("Well").AppendInterjection("boing", true).AppendPlainSpeech("!")
+		}, "Well, " + boing + "!"},
+		{"before an element", func(b *SSMLTextBuilder) *SSMLTextBuilder {
+			return b.AppendInterjection("boing", true).AppendBreak(BreakMedium, 0)
+		}, boing + `, <break strength="medium"/>`},
+	}
+
+	for _, test := range tests {
+		builder := test.build(NewSSMLTextBuilder())
+		if err := builder.Err(); err != nil {
+			t.Errorf("%s: error = %v", test.name, err)
+			continue
+		}
+
+		if got, want := builder.Build(), "<speak>"+test.want+"</speak>"; got != want {
+			t.Errorf("%s: Build() = %s, want %s", test.name, got, want)
+		}
+	}
+}
+
+func TestWithAutoSpace(t *testing.T) {
+	builder := NewSSMLTextBuilder(WithAutoSpace(true)).
+		AppendPlainSpeech("Hello").
+		AppendPlainSpeech("world").
+		AppendPlainSpeech(" again")
+	if got, want := builder.Inner(), "Hello world again"; got != want {
+		t.Errorf("plain speech = %q, want %q", got, want)
+	}
+
+	builder = NewSSMLTextBuilder(WithAutoSpace(true)).
+		AppendPlainSpeech("a").
+		AppendEmphasisContent(EmphasisStrong, func(inner *SSMLTextBuilder) {
+			inner.AppendPlainSpeech("b")
+		})
+	if got, want := builder.Inner(), `a<emphasis level="strong">b</emphasis>`; got != want {
+		t.Errorf("nested content = %q, want %q", got, want)
+	}
+
+	builder = NewSSMLTextBuilder(WithAutoSpace(true))
+	tmpl := template.Must(template.New("greeting").Parse("Hello {{.}}!"))
+	if err := tmpl.Execute(builder, "Bob"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := builder.Inner(), "Hello Bob!"; got != want {
+		t.Errorf("template = %q, want %q", got, want)
+	}
+}
+
+func TestAppendProsodyNoStraySpace(t *testing.T) {
+	got := NewSSMLTextBuilder().AppendProsody("text", RateSlow, "", "").Inner()
+
+	if want := `<prosody rate="slow">text</prosody>`; got != want {
+		t.Errorf("AppendProsody = %s, want %s", got, want)
+	}
+}
+
+// buildSink keeps benchmark results alive so the compiler cannot drop the
+// work.
+var buildSink string
+
+// sprintfBuild is how Build assembled the speak document before it was
+// rewritten to avoid fmt.Sprintf.
+func sprintfBuild(builder *SSMLTextBuilder) string {
+	return fmt.Sprintf("%s%s</speak>", builder.speakTag(), builder.buffer.String())
+}
+
+func TestBuildMatchesSprintf(t *testing.T) {
+	builders := []*SSMLTextBuilder{
+		NewSSMLTextBuilder(),
+		NewSSMLTextBuilder().AppendPlainSpeech("Hi"),
+		NewSSMLTextBuilder(WithSpeakLang("de-DE")).AppendSentence("Hallo").AppendBreakTime(time.Second),
+	}
+
+	for _, builder := range builders {
+		if got, want := builder.Build(), sprintfBuild(builder); got != want {
+			t.Errorf("Build() = %s, want %s", got, want)
+		}
+	}
+}
+
+func BenchmarkBuild(b *testing.B) {
+	builder := NewSSMLTextBuilder().AppendPlainSpeech("Welcome back.")
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		buildSink = builder.Build()
+	}
+}
+
+func BenchmarkBuildSprintf(b *testing.B) {
+	builder := NewSSMLTextBuilder().AppendPlainSpeech("Welcome back.")
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		buildSink = sprintfBuild(builder)
+	}
+}
+
+// appendCommonSprintf appends the same elements as appendCommon the way the
+// Append methods did before they wrote straight to the buffer.
+func appendCommonSprintf(builder *SSMLTextBuilder) *SSMLTextBuilder {
+	return builder.
+		AppendRaw(fmt.Sprintf("<amazon:effect name=\"%s\">%s</amazon:effect>", EffectWhispered, "psst")).
+		AppendRaw(fmt.Sprintf("<emphasis level=\"%s\">%s</emphasis>", EmphasisStrong, "now")).
+		AppendRaw(fmt.Sprintf("<p>%s</p>", "Tom &amp; Jerry")).
+		AppendRaw(fmt.Sprintf("<s>%s</s>", "Hi.")).
+		AppendRaw(fmt.Sprintf("<sub alias=\"%s\">%s</sub>", "aluminium", "Al"))
+}
+
+func appendCommon(builder *SSMLTextBuilder) *SSMLTextBuilder {
+	return builder.
+		AppendAmazonEffect("psst", EffectWhispered).
+		AppendEmphasis("now", EmphasisStrong).
+		AppendParagraph("Tom & Jerry").
+		AppendSentence("Hi.").
+		AppendSubstitution("Al", "aluminium")
+}
+
+func TestAppendCommonMatchesSprintf(t *testing.T) {
+	got := appendCommon(NewSSMLTextBuilder()).Build()
+
+	if want := appendCommonSprintf(NewSSMLTextBuilder()).Build(); got != want {
+		t.Errorf("Append methods = %s, want %s", got, want)
+	}
+}
+
+func BenchmarkAppendCommon(b *testing.B) {
+	builder := NewSSMLTextBuilder(WithCapacity(1024))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		appendCommon(builder.Reset())
+	}
+}
+
+func BenchmarkAppendCommonSprintf(b *testing.B) {
+	builder := NewSSMLTextBuilder(WithCapacity(1024))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		appendCommonSprintf(builder.Reset())
+	}
+}
+
+func TestAppendSSML(t *testing.T) {
+	tests := []struct {
+		fragment string
+		want     string
+		wantErr  bool
+	}{
+		{`<speak>Hi <break time="1s"/></speak>`, `Hi <break time="1s"/>`, false},
+		{`<s>One</s>`, `<s>One</s>`, false},
+		{`a</speak><speak>b`, "", true},
+		{`<speak>a<speak>b</speak></speak>`, "", true},
+		{`<p>unclosed`, "", true},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendSSML(test.fragment)
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("AppendSSML(%s) = %s, want %s", test.fragment, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendSSML(%s) error = %v, want error %v", test.fragment, err, test.wantErr)
+		}
+	}
+}
+
+func TestAppendSSMLCountsAudio(t *testing.T) {
+	builder := NewSSMLTextBuilder()
+
+	for i := 0; i < MaxAudioCount; i++ {
+		builder.AppendSSML(`<audio src="https://example.com/clip.mp3"/>`)
+	}
+
+	if got := builder.AudioCount(); got != MaxAudioCount || builder.Err() != nil {
+		t.Fatalf("AudioCount() = %d, %v, want %d", got, builder.Err(), MaxAudioCount)
+	}
+
+	if builder.AppendSSML(`<audio src="https://example.com/clip.mp3"/>`).Err() == nil {
+		t.Errorf("sixth audio through AppendSSML: error = nil")
+	}
+}
+
+func TestAppendPhoneme(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendPhoneme("pecan", "", "pɪˈkɑːn")
+	if got, want := builder.Inner(), `<phoneme alphabet="ipa" ph="pɪˈkɑːn">pecan</phoneme>`; got != want || builder.Err() != nil {
+		t.Errorf("AppendPhoneme = %s, %v, want %s", got, builder.Err(), want)
+	}
+
+	builder = NewSSMLTextBuilder().AppendPhoneme("pecan", PhonemeXSampa, "")
+	if builder.Err() == nil {
+		t.Errorf("empty ph = %s, want an error", builder.Build())
+	}
+}
+
+func TestGrow(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendPlainSpeech("Hi")
+	before := builder.Build()
+
+	builder.Grow(4096).Grow(-1)
+
+	if got := builder.Build(); got != before {
+		t.Errorf("Build() after Grow = %s, want %s", got, before)
+	}
+
+	if got := builder.buffer.Cap() - builder.buffer.Len(); got < 4096 {
+		t.Errorf("spare capacity after Grow(4096) = %d", got)
+	}
+}
+
+func TestAppendRepeatedAudio(t *testing.T) {
+	const src = "https://example.com/clip.mp3"
+
+	tests := []struct {
+		count   int
+		want    string
+		wantErr bool
+	}{
+		{0, "", true},
+		{1, `<audio src="` + src + `" repeatCount="1"/>`, false},
+		{10, `<audio src="` + src + `" repeatCount="10"/>`, false},
+		{11, "", true},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendRepeatedAudio(src, test.count)
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("AppendRepeatedAudio(%d) = %s, want %s", test.count, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendRepeatedAudio(%d) error = %v, want error %v", test.count, err, test.wantErr)
+		}
+	}
+
+	if NewSSMLTextBuilder().AppendRepeatedAudio("http://example.com/clip.mp3", 2).Err() == nil {
+		t.Error("AppendRepeatedAudio with an HTTP src: error = nil")
+	}
+}
+
+func TestAppendEmphasizedSentence(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendEmphasizedSentence("Watch out!", EmphasisStrong)
+
+	if got, want := builder.Inner(), `<s><emphasis level="strong">Watch out!</emphasis></s>`; got != want || builder.Err() != nil {
+		t.Errorf("AppendEmphasizedSentence = %s, %v, want %s", got, builder.Err(), want)
+	}
+}
+
+func TestAppendBreakMillis(t *testing.T) {
+	tests := []struct {
+		ms      int
+		want    string
+		wantErr bool
+	}{
+		{0, "", true},
+		{1, `<break time="1ms"/>`, false},
+		{500, `<break time="500ms"/>`, false},
+		{10000, `<break time="10000ms"/>`, false},
+		{10001, "", true},
+		{-1, "", true},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendBreakMillis(test.ms)
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("AppendBreakMillis(%d) = %s, want %s", test.ms, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendBreakMillis(%d) error = %v, want error %v", test.ms, err, test.wantErr)
+		}
+	}
+}
+
+func TestAppendWithBreakAfter(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     string
+		wantErr  bool
+	}{
+		{500 * time.Millisecond, `Hello<break time="500ms"/>`, false},
+		{10 * time.Second, `Hello<break time="10000ms"/>`, false},
+		{0, "", true},
+		{-time.Second, "", true},
+		{10*time.Second + time.Millisecond, "", true},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendWithBreakAfter("Hello", test.duration)
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("AppendWithBreakAfter(%v) = %s, want %s", test.duration, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendWithBreakAfter(%v) error = %v, want error %v", test.duration, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateNesting(t *testing.T) {
+	allowed := NewSSMLTextBuilder().AppendRaw(`<p><s>One.</s><s>Two.</s></p>`)
+	if err := allowed.Validate(); err != nil {
+		t.Errorf("sentences inside a paragraph: Validate() = %v", err)
+	}
+
+	forbidden := NewSSMLTextBuilder().AppendRaw(`<s><p>One.</p></s>`)
+	err := forbidden.Validate()
+	if err == nil || !strings.Contains(err.Error(), "<p>") || !strings.Contains(err.Error(), "<s>") {
+		t.Errorf("paragraph inside a sentence: Validate() = %v, want an error naming <p> and <s>", err)
+	}
+}
+
+func TestSSMLFromTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("prosody").Parse(`<prosody rate="{{.Rate}}">{{.Text}}</prosody>`))
+
+	builder, err := SSMLFromTemplate(tmpl, map[string]string{"Rate": RateSlow, "Text": "Take your time."})
+	if err != nil {
+		t.Fatalf("SSMLFromTemplate error = %v", err)
+	}
+
+	if got, want := builder.Build(), `<speak><prosody rate="slow">Take your time.</prosody></speak>`; got != want {
+		t.Errorf("SSMLFromTemplate = %s, want %s", got, want)
+	}
+
+	broken := template.Must(template.New("broken").Parse(`<prosody rate="slow">{{.}}`))
+	if _, err := SSMLFromTemplate(broken, "unclosed"); err == nil {
+		t.Error("template with an unclosed element: error = nil")
+	}
+}
+
+func TestSSMLFromTemplateCountsAudio(t *testing.T) {
+	tmpl := template.Must(template.New("audio").Parse(`{{range .}}<audio src="{{.}}"/>{{end}}`))
+	srcs := make([]string, MaxAudioCount)
+	for i := range srcs {
+		srcs[i] = "https://example.com/clip.mp3"
+	}
+
+	builder, err := SSMLFromTemplate(tmpl, srcs)
+	if err != nil {
+		t.Fatalf("SSMLFromTemplate error = %v", err)
+	}
+
+	if got := builder.AudioCount(); got != MaxAudioCount {
+		t.Errorf("AudioCount() = %d, want %d", got, MaxAudioCount)
+	}
+
+	if builder.AppendAudio("https://example.com/clip.mp3").Err() == nil {
+		t.Error("appending a sixth audio after SSMLFromTemplate: error = nil")
+	}
+
+	if _, err := SSMLFromTemplate(tmpl, append(srcs, "https://example.com/clip.mp3")); err == nil {
+		t.Error("template with six audio elements: error = nil")
+	}
+}
+
+func TestBuildChunks(t *testing.T) {
+	builder := NewSSMLTextBuilder().
+		AppendPlainSpeech("Dr. Smith is in. ").
+		AppendEmphasis("Please wait.", EmphasisStrong).
+		AppendPlainSpeech(" Thank you.")
+
+	chunks, err := builder.BuildChunks(80)
+	if err != nil {
+		t.Fatalf("BuildChunks error = %v", err)
+	}
+
+	want := []string{
+		`<speak>Dr. Smith is in. <emphasis level="strong">Please wait.</emphasis></speak>`,
+		`<speak>Thank you.</speak>`,
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("BuildChunks = %q, want %q", chunks, want)
+	}
+
+	for i := range want {
+		if chunks[i] != want[i] {
+			t.Errorf("chunk %d = %s, want %s", i, chunks[i], want[i])
+		}
+
+		if len(chunks[i]) > 80 {
+			t.Errorf("chunk %d is %d characters, over 80", i, len(chunks[i]))
+		}
+	}
+
+	chunks, err = builder.BuildChunks(0)
+	if err != nil || len(chunks) != 1 || chunks[0] != builder.Build() {
+		t.Errorf("BuildChunks(0) = %q, %v, want the whole document", chunks, err)
+	}
+}
+
+func TestBuildChunksElementTooLarge(t *testing.T) {
+	builder := NewSSMLTextBuilder().
+		AppendPlainSpeech("Short. ").
+		AppendEmphasis("This emphasis is far too long to fit.", EmphasisStrong)
+
+	if _, err := builder.BuildChunks(40); err == nil {
+		t.Error("element longer than max: error = nil")
+	}
+}
+
+func TestBuildChunksSpeakLang(t *testing.T) {
+	builder := NewSSMLTextBuilder(WithSpeakLang("de-DE")).AppendPlainSpeech("Eins. Zwei.")
+
+	chunks, err := builder.BuildChunks(len(`<speak xml:lang="de-DE">Eins.</speak>`))
+	if err != nil {
+		t.Fatalf("BuildChunks error = %v", err)
+	}
+
+	want := []string{`<speak xml:lang="de-DE">Eins.</speak>`, `<speak xml:lang="de-DE">Zwei.</speak>`}
+	if len(chunks) != len(want) || chunks[0] != want[0] || chunks[1] != want[1] {
+		t.Errorf("BuildChunks = %q, want %q", chunks, want)
+	}
+}
+
+func TestAppendProsodyContent(t *testing.T) {
+	emphasis := NewSSMLTextBuilder().AppendEmphasis("now", EmphasisStrong)
+
+	builder := NewSSMLTextBuilder().AppendVoiceContent(VoiceMatthew, func(voice *SSMLTextBuilder) {
+		voice.AppendProsodyContent(ProsodyOptions{Rate: RateSlow}, func(prosody *SSMLTextBuilder) {
+			prosody.AppendPlainSpeech("Listen ").AppendBuilder(emphasis)
+		})
+	})
+
+	want := `<voice name="Matthew"><prosody rate="slow">Listen <emphasis level="strong">now</emphasis></prosody></voice>`
+	if got := builder.Inner(); got != want {
+		t.Errorf("nested content = %s, want %s", got, want)
+	}
+
+	if err := builder.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+
+	empty := NewSSMLTextBuilder().AppendProsodyContent(ProsodyOptions{}, func(*SSMLTextBuilder) {})
+	if empty.Err() == nil {
+		t.Errorf("prosody content without values = %s, want an error", empty.Build())
+	}
+
+	strict := NewSSMLTextBuilder(WithStrictTags(true)).AppendVoiceContent("Mathew", func(*SSMLTextBuilder) {})
+	if strict.Err() == nil {
+		t.Errorf("strict unknown voice content = %s, want an error", strict.Build())
+	}
+}
+
+func TestAppendProsodyDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		want     string
+		wantErr  bool
+	}{
+		{3 * time.Second, `<prosody duration="3000ms">text</prosody>`, false},
+		{time.Microsecond, `<prosody duration="1ms">text</prosody>`, false},
+		{1500 * time.Microsecond, `<prosody duration="2ms">text</prosody>`, false},
+		{0, "", true},
+		{-time.Second, "", true},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendProsodyDuration("text", test.duration)
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("AppendProsodyDuration(%s) = %s, want %s", test.duration, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendProsodyDuration(%s) error = %v, want error %v", test.duration, err, test.wantErr)
+		}
+	}
+
+	if err := NewSSMLTextBuilder().AppendProsodyDuration("text", 3*time.Second).Validate(); err != nil {
+		t.Errorf("duration only: Validate() = %v", err)
+	}
+
+	conflict := NewSSMLTextBuilder().AppendSSML(`<prosody rate="slow" duration="3s">text</prosody>`)
+	if conflict.Err() == nil {
+		t.Errorf("rate and duration = %s, want an error", conflict.Build())
+	}
+}
+
+func TestBuildIndented(t *testing.T) {
+	builder := NewSSMLTextBuilder(WithSpeakLang("en-GB")).
+		AppendParagraph("Tom & Jerry").
+		AppendBreakStrength(BreakStrong).
+		AppendEmphasisContent(EmphasisStrong, func(inner *SSMLTextBuilder) {
+			inner.AppendPlainSpeech("Hi ").AppendBreakTime(time.Second)
+		}).
+		AppendWhisper("psst")
+
+	want := `<speak xml:lang="en-GB">
+  <p>
+    Tom &amp; Jerry
+  </p>
+  <break strength="strong"/>
+  <emphasis level="strong">
+    Hi
+    <break time="1000ms"/>
+  </emphasis>
+  <amazon:effect name="whispered">
+    psst
+  </amazon:effect>
+</speak>
+`
+	if got := builder.BuildIndented(); got != want {
+		t.Errorf("BuildIndented() =\n%s\nwant\n%s", got, want)
+	}
+
+	broken := NewSSMLTextBuilder().AppendRaw("<p>unclosed")
+	if got, want := broken.BuildIndented(), broken.Build(); got != want {
+		t.Errorf("malformed BuildIndented() = %s, want %s", got, want)
+	}
+}
+
+func TestAppendCurrency(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   string
+	}{
+		{"5.99", `<say-as interpret-as="unit">$5.99</say-as>`},
+		{"$5.99", `<say-as interpret-as="unit">$5.99</say-as>`},
+		{"0.99", `<say-as interpret-as="unit">$0.99</say-as>`},
+		{"$12", `<say-as interpret-as="unit">$12</say-as>`},
+		{" 12 ", `<say-as interpret-as="unit">$12</say-as>`},
+		{"-5", `<say-as interpret-as="unit">-$5</say-as>`},
+		{"-$5.50", `<say-as interpret-as="unit">-$5.50</say-as>`},
+	}
+
+	for _, test := range tests {
+		if got := NewSSMLTextBuilder().AppendCurrency(test.amount).Inner(); got != test.want {
+			t.Errorf("AppendCurrency(%q) = %s, want %s", test.amount, got, test.want)
+		}
+	}
+}
+
+func TestAppendRaw(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendRaw(`<s>Tom &amp; Jerry</s>`)
+
+	if got, want := builder.Build(), `<speak><s>Tom &amp; Jerry</s></speak>`; got != want {
+		t.Errorf("AppendRaw = %s, want %s", got, want)
+	}
+
+	if err := builder.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	const text = `Tom & Jerry <3 > "cats"`
+	const escaped = `Tom &amp; Jerry &lt;3 &gt; &quot;cats&quot;`
+
+	tests := []struct {
+		name    string
+		builder *SSMLTextBuilder
+		want    string
+	}{
+		{"AppendPlainSpeech", NewSSMLTextBuilder().AppendPlainSpeech(text), escaped},
+		{"AppendEmphasis", NewSSMLTextBuilder().AppendEmphasis(text, EmphasisStrong), `<emphasis level="strong">` + escaped + `</emphasis>`},
+		{"AppendParagraph", NewSSMLTextBuilder().AppendParagraph(text), `<p>` + escaped + `</p>`},
+		{"AppendSentence", NewSSMLTextBuilder().AppendSentence(text), `<s>` + escaped + `</s>`},
+		{"AppendSubstitution", NewSSMLTextBuilder().AppendSubstitution(text, text), `<sub alias="` + escaped + `">` + escaped + `</sub>`},
+		{"AppendProsody", NewSSMLTextBuilder().AppendProsody(text, RateSlow, "", ""), `<prosody rate="slow">` + escaped + `</prosody>`},
+		{"AppendAmazonEffect", NewSSMLTextBuilder().AppendAmazonEffect(text, EffectWhispered), `<amazon:effect name="whispered">` + escaped + `</amazon:effect>`},
+	}
+
+	for _, test := range tests {
+		if got := test.builder.Inner(); got != test.want {
+			t.Errorf("%s = %s, want %s", test.name, got, test.want)
+		}
+
+		if err := test.builder.Validate(); err != nil {
+			t.Errorf("%s: Validate() = %v", test.name, err)
+		}
+	}
+}
+
+func TestLen(t *testing.T) {
+	builder := NewSSMLTextBuilder().
+		AppendPlainSpeech("Café ").
+		AppendEmphasis("now", EmphasisStrong)
+
+	if got, want := builder.Len(), len([]rune(`<speak>Café <emphasis level="strong">now</emphasis></speak>`)); got != want {
+		t.Errorf("Len() = %d, want %d", got, want)
+	}
+
+	if got, want := builder.TextLen(), len([]rune("Café now")); got != want {
+		t.Errorf("TextLen() = %d, want %d", got, want)
+	}
+}
+
+func TestBuildWithLimit(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendPlainSpeech("Hello")
+	length := len("<speak>Hello</speak>")
+
+	if got, err := builder.BuildWithLimit(length); err != nil || got != builder.Build() {
+		t.Errorf("BuildWithLimit(%d) = %s, %v, want %s", length, got, err, builder.Build())
+	}
+
+	_, err := builder.BuildWithLimit(length - 1)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprint(length)) {
+		t.Errorf("BuildWithLimit(%d) error = %v, want one reporting %d characters", length-1, err, length)
+	}
+
+	limited := NewSSMLTextBuilder(WithMaxLen(length - 1)).AppendPlainSpeech("Hello")
+	if _, err := limited.BuildWithLimit(0); err == nil {
+		t.Errorf("BuildWithLimit(0) with WithMaxLen(%d): error = nil", length-1)
+	}
+
+	if _, err := builder.BuildWithLimit(0); err != nil {
+		t.Errorf("BuildWithLimit(0) with the default limit: error = %v", err)
+	}
+}
+
+func TestAppendInterjection(t *testing.T) {
+	for _, speechcon := range []string{"abracadabra", "boing"} {
+		want := `<say-as interpret-as="interjection">` + speechcon + `</say-as>`
+		if got := NewSSMLTextBuilder().AppendInterjection(speechcon, false).Inner(); got != want {
+			t.Errorf("AppendInterjection(%q) = %s, want %s", speechcon, got, want)
+		}
+	}
+}
+
+func TestSayAsHelpers(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SSMLTextBuilder
+		want    string
+	}{
+		{"AppendTelephone formatted", NewSSMLTextBuilder().AppendTelephone("1-800-555-0199"), `<say-as interpret-as="telephone">1-800-555-0199</say-as>`},
+		{"AppendTelephone unformatted", NewSSMLTextBuilder().AppendTelephone("18005550199"), `<say-as interpret-as="telephone">18005550199</say-as>`},
+		{"AppendUnit ft", NewSSMLTextBuilder().AppendUnit("10 ft"), `<say-as interpret-as="unit">10 ft</say-as>`},
+		{"AppendUnit kg", NewSSMLTextBuilder().AppendUnit("5kg"), `<say-as interpret-as="unit">5kg</say-as>`},
+		{"AppendUnit currency", NewSSMLTextBuilder().AppendUnit("$5 each"), `<say-as interpret-as="unit">$5 each</say-as>`},
+		{"AppendFraction", NewSSMLTextBuilder().AppendFraction("1/2"), `<say-as interpret-as="fraction">1/2</say-as>`},
+		{"AppendFraction mixed", NewSSMLTextBuilder().AppendFraction("1+1/2"), `<say-as interpret-as="fraction">1+1/2</say-as>`},
+		{"AppendOrdinal", NewSSMLTextBuilder().AppendOrdinal("1"), `<say-as interpret-as="ordinal">1</say-as>`},
+		{"AppendOrdinal multi-digit", NewSSMLTextBuilder().AppendOrdinal("42"), `<say-as interpret-as="ordinal">42</say-as>`},
+		{"AppendDigits", NewSSMLTextBuilder().AppendDigits("1234"), `<say-as interpret-as="digits">1234</say-as>`},
+		{"AppendAddress", NewSSMLTextBuilder().AppendAddress("150 E Dana St"), `<say-as interpret-as="address">150 E Dana St</say-as>`},
+		{"AppendExpletive", NewSSMLTextBuilder().AppendExpletive("darn"), `<say-as interpret-as="expletive">darn</say-as>`},
+		{"AppendWord present", NewSSMLTextBuilder().AppendWord("read", WordRoleVerbPresent), `<w role="amazon:VB">read</w>`},
+		{"AppendWord past", NewSSMLTextBuilder().AppendWord("read", WordRoleVerbPast), `<w role="amazon:VBD">read</w>`},
+		{"AppendWord noun", NewSSMLTextBuilder().AppendWord("lead", WordRoleNoun), `<w role="amazon:NN">lead</w>`},
+		{"AppendWord sense", NewSSMLTextBuilder().AppendWord("bass", WordRoleSenseNonDefault), `<w role="amazon:SENSE_1">bass</w>`},
+	}
+
+	for _, test := range tests {
+		if got := test.builder.Inner(); got != test.want {
+			t.Errorf("%s = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAppendMark(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendMark("chapter_1")
+	if got, want := builder.Inner(), `<mark name="chapter_1"/>`; got != want {
+		t.Errorf("AppendMark(chapter_1) = %s, want %s", got, want)
+	}
+
+	if err := builder.Err(); err != nil {
+		t.Errorf("AppendMark(chapter_1) error = %v", err)
+	}
+
+	rejected := NewSSMLTextBuilder().AppendMark("chapter one")
+	if rejected.Err() == nil || rejected.Inner() != "" {
+		t.Errorf("AppendMark(chapter one) = %s, want an error", rejected.Inner())
+	}
+}
+
+func TestProsodyConstants(t *testing.T) {
+	tests := []struct {
+		constant string
+		want     string
+	}{
+		{RateXSlow, "x-slow"},
+		{RateSlow, "slow"},
+		{RateMedium, "medium"},
+		{RateFast, "fast"},
+		{RateXFast, "x-fast"},
+		{PitchXLow, "x-low"},
+		{PitchLow, "low"},
+		{PitchMedium, "medium"},
+		{PitchHigh, "high"},
+		{PitchXHigh, "x-high"},
+		{VolumeSilent, "silent"},
+		{VolumeXSoft, "x-soft"},
+		{VolumeSoft, "soft"},
+		{VolumeMedium, "medium"},
+		{VolumeLoud, "loud"},
+		{VolumeXLoud, "x-loud"},
+	}
+
+	for _, test := range tests {
+		if test.constant != test.want {
+			t.Errorf("prosody constant = %q, want %q", test.constant, test.want)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	original := NewSSMLTextBuilder().AppendPlainSpeech("Hello ")
+	clone := original.Clone()
+
+	original.AppendPlainSpeech("world")
+	clone.AppendPlainSpeech("there")
+
+	if got, want := original.Build(), "<speak>Hello world</speak>"; got != want {
+		t.Errorf("original Build() = %s, want %s", got, want)
+	}
+
+	if got, want := clone.Build(), "<speak>Hello there</speak>"; got != want {
+		t.Errorf("clone Build() = %s, want %s", got, want)
+	}
+}
+
+func TestAppendIf(t *testing.T) {
+	greet := func(builder *SSMLTextBuilder) *SSMLTextBuilder {
+		return builder.AppendPlainSpeech("Good morning. ")
+	}
+
+	if got, want := NewSSMLTextBuilder().AppendIf(true, greet).AppendPlainSpeech("Hi").Inner(), "Good morning. Hi"; got != want {
+		t.Errorf("AppendIf(true) = %s, want %s", got, want)
+	}
+
+	if got, want := NewSSMLTextBuilder().AppendIf(false, greet).AppendPlainSpeech("Hi").Inner(), "Hi"; got != want {
+		t.Errorf("AppendIf(false) = %s, want %s", got, want)
+	}
+}
+
+func TestAmazonEffects(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SSMLTextBuilder
+		want    string
+	}{
+		{"AppendWhisper", NewSSMLTextBuilder().AppendWhisper("psst"), `<amazon:effect name="whispered">psst</amazon:effect>`},
+		{"AppendPhonation", NewSSMLTextBuilder().AppendPhonation("quietly", PhonationSoft), `<amazon:effect phonation="soft">quietly</amazon:effect>`},
+		{"EffectDRC", NewSSMLTextBuilder().AppendAmazonEffect("loud and clear", EffectDRC), `<amazon:effect name="drc">loud and clear</amazon:effect>`},
+		{"AppendProsodyDefault", NewSSMLTextBuilder().AppendProsodyDefault("normal"), `<prosody rate="medium" pitch="medium" volume="medium">normal</prosody>`},
+	}
+
+	for _, test := range tests {
+		if got := test.builder.Inner(); got != test.want {
+			t.Errorf("%s = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAppendVocalTractLength(t *testing.T) {
+	tests := []struct {
+		percent int
+		want    string
+		wantErr bool
+	}{
+		{49, "", true},
+		{50, `<amazon:effect vocal-tract-length="50%">text</amazon:effect>`, false},
+		{200, `<amazon:effect vocal-tract-length="200%">text</amazon:effect>`, false},
+		{201, "", true},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendVocalTractLength("text", test.percent)
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("AppendVocalTractLength(%d) = %s, want %s", test.percent, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendVocalTractLength(%d) error = %v, want error %v", test.percent, err, test.wantErr)
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendPlainSpeech("Tom & Jerry")
+
+	data, err := json.Marshal(struct {
+		OutputSpeech *SSMLTextBuilder `json:"outputSpeech"`
+	}{builder})
+	if err != nil {
+		t.Fatalf("json.Marshal error = %v", err)
+	}
+
+	var decoded struct {
+		OutputSpeech struct {
+			Type string `json:"type"`
+			SSML string `json:"ssml"`
+		} `json:"outputSpeech"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal(%s) error = %v", data, err)
+	}
+
+	if decoded.OutputSpeech.Type != "SSML" || decoded.OutputSpeech.SSML != builder.Build() {
+		t.Errorf("round trip = %+v, want type SSML and ssml %s", decoded.OutputSpeech, builder.Build())
+	}
+
+	failed := NewSSMLTextBuilder().AppendBreakTime(-time.Second)
+	if _, err := json.Marshal(failed); err == nil || !strings.Contains(err.Error(), failed.Err().Error()) {
+		t.Errorf("json.Marshal of a failed builder error = %v, want %v", err, failed.Err())
+	}
+}
+
+func TestReader(t *testing.T) {
+	builder := NewSSMLTextBuilder(WithSpeakLang("en-GB")).AppendSentence("Hello").AppendBreakTime(time.Second)
+
+	got, err := ioutil.ReadAll(builder.Reader())
+	if err != nil {
+		t.Fatalf("ReadAll error = %v", err)
+	}
+
+	if want := builder.Build(); string(got) != want {
+		t.Errorf("ReadAll(Reader()) = %s, want %s", got, want)
+	}
+}
+
+func TestAppendNumber(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SSMLTextBuilder
+		want    string
+	}{
+		{"AppendNumber(42)", NewSSMLTextBuilder().AppendNumber(42), `<say-as interpret-as="cardinal">42</say-as>`},
+		{"AppendNumber(0)", NewSSMLTextBuilder().AppendNumber(0), `<say-as interpret-as="cardinal">0</say-as>`},
+		{"AppendNumber(-7)", NewSSMLTextBuilder().AppendNumber(-7), `<say-as interpret-as="cardinal">-7</say-as>`},
+		{"AppendOrdinalNumber(2)", NewSSMLTextBuilder().AppendOrdinalNumber(2), `<say-as interpret-as="ordinal">2</say-as>`},
+		{"AppendOrdinalNumber(0)", NewSSMLTextBuilder().AppendOrdinalNumber(0), `<say-as interpret-as="ordinal">0</say-as>`},
+		{"AppendOrdinalNumber(-3)", NewSSMLTextBuilder().AppendOrdinalNumber(-3), `<say-as interpret-as="ordinal">-3</say-as>`},
+	}
+
+	for _, test := range tests {
+		if got := test.builder.Inner(); got != test.want {
+			t.Errorf("%s = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSpeak(t *testing.T) {
+	got, err := Speak(`Tom & Jerry <3 "cats"`)
+	if err != nil {
+		t.Fatalf("Speak error = %v", err)
+	}
+
+	if want := `<speak>Tom &amp; Jerry &lt;3 &quot;cats&quot;</speak>`; got != want {
+		t.Errorf("Speak = %s, want %s", got, want)
+	}
+
+	if err := validateSSML(got); err != nil {
+		t.Errorf("Speak output is not valid SSML: %v", err)
+	}
+}
+
+func TestAppendSpellOut(t *testing.T) {
+	if got, want := NewSSMLTextBuilder().AppendSpellOut("AB12c").Inner(), `<say-as interpret-as="spell-out">AB12c</say-as>`; got != want {
+		t.Errorf("AppendSpellOut = %s, want %s", got, want)
+	}
+}
+
+func TestAppendEmphasisContent(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendEmphasisContent(EmphasisStrong, func(inner *SSMLTextBuilder) {
+		inner.AppendPlainSpeech("Call ").AppendTelephone("555-0199")
+	})
+
+	want := `<emphasis level="strong">Call <say-as interpret-as="telephone">555-0199</say-as></emphasis>`
+	if got := builder.Inner(); got != want {
+		t.Errorf("AppendEmphasisContent = %s, want %s", got, want)
+	}
+
+	if err := builder.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestAppendVoiceEscapesName(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendVoice("Hi", `Ivy" pitch="high`)
+
+	if got, want := builder.Inner(), `<voice name="Ivy&quot; pitch=&quot;high">Hi</voice>`; got != want {
+		t.Errorf("AppendVoice = %s, want %s", got, want)
+	}
+
+	if err := builder.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestMustPanics(t *testing.T) {
+	panics := func(name string, fn func()) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s did not panic", name)
+			}
+		}()
+
+		fn()
+	}
+
+	panics("Must", func() { NewSSMLTextBuilder().AppendAudio("http://example.com/clip.mp3").Must() })
+	panics("MustBuild", func() { NewSSMLTextBuilder().AppendAudio("http://example.com/clip.mp3").MustBuild() })
+
+	if got, want := NewSSMLTextBuilder().AppendPlainSpeech("Hi").MustBuild(), "<speak>Hi</speak>"; got != want {
+		t.Errorf("MustBuild() = %s, want %s", got, want)
+	}
+}
+
+func TestAppendList(t *testing.T) {
+	got := NewSSMLTextBuilder().AppendList([]string{"first", "second", "third"}, BreakStrong).Inner()
+
+	want := `<s>first</s><break strength="strong"/><s>second</s><break strength="strong"/><s>third</s>`
+	if got != want {
+		t.Errorf("AppendList = %s, want %s", got, want)
+	}
+}
+
+func TestCounts(t *testing.T) {
+	builder := NewSSMLTextBuilder().
+		AppendAudio("https://example.com/one.mp3").
+		AppendBreakTime(time.Second).
+		AppendEmphasis("now", EmphasisStrong).
+		AppendAudio("https://example.com/two.mp3").
+		AppendWhisper("psst").
+		AppendBreakStrength(BreakWeak)
+
+	want := map[string]int{"audio": 2, "break": 2, "emphasis": 1, "amazon:effect": 1}
+	got := builder.Counts()
+
+	if len(got) != len(want) {
+		t.Errorf("Counts() = %v, want %v", got, want)
+	}
+
+	for tag, count := range want {
+		if got[tag] != count {
+			t.Errorf("Counts()[%q] = %d, want %d", tag, got[tag], count)
+		}
+	}
+}
+
+func TestAppendSentences(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Hello there. How are you?", `<s>Hello there.</s><s>How are you?</s>`},
+		{"Dr. Smith is in. Please wait!", `<s>Dr. Smith is in.</s><s>Please wait!</s>`},
+		{"One. Two.  \n\t", `<s>One.</s><s>Two.</s>`},
+		{"No punctuation", `<s>No punctuation</s>`},
+	}
+
+	for _, test := range tests {
+		if got := NewSSMLTextBuilder().AppendSentences(test.text).Inner(); got != test.want {
+			t.Errorf("AppendSentences(%q) = %s, want %s", test.text, got, test.want)
+		}
+	}
+}
+
+func TestAppendVoice(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *SSMLTextBuilder
+		want    string
+		wantErr bool
+	}{
+		{"valid", NewSSMLTextBuilder(WithStrictTags(true)).AppendVoice("Hi", VoiceMatthew), `<voice name="Matthew">Hi</voice>`, false},
+		{"misspelled", NewSSMLTextBuilder(WithStrictTags(true)).AppendVoice("Hi", "Mathew"), "", true},
+		{"custom in lax mode", NewSSMLTextBuilder().AppendVoice("Hi", "Custom"), `<voice name="Custom">Hi</voice>`, false},
+	}
+
+	for _, test := range tests {
+		if got := test.builder.Inner(); got != test.want {
+			t.Errorf("%s: AppendVoice = %s, want %s", test.name, got, test.want)
+		}
+
+		if err := test.builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+
+	if !ValidVoice(VoiceMatthew) || ValidVoice("Mathew") {
+		t.Error("ValidVoice does not match the Voice* constants")
+	}
+}
+
+func TestWithSpeakLang(t *testing.T) {
+	if got, want := NewSSMLTextBuilder().AppendPlainSpeech("Hi").Build(), "<speak>Hi</speak>"; got != want {
+		t.Errorf("without WithSpeakLang: Build() = %s, want %s", got, want)
+	}
+
+	if got, want := NewSSMLTextBuilder(WithSpeakLang("de-DE")).AppendPlainSpeech("Hallo").Build(), `<speak xml:lang="de-DE">Hallo</speak>`; got != want {
+		t.Errorf("WithSpeakLang(de-DE): Build() = %s, want %s", got, want)
+	}
+
+	unsupported := NewSSMLTextBuilder(WithSpeakLang("xx-XX")).AppendPlainSpeech("Hi")
+	if unsupported.Err() == nil {
+		t.Error("WithSpeakLang(xx-XX): error = nil")
+	}
+
+	if got, want := unsupported.Build(), "<speak></speak>"; got != want {
+		t.Errorf("WithSpeakLang(xx-XX): Build() = %s, want %s", got, want)
+	}
+}
+
+func TestWithElementBudget(t *testing.T) {
+	builder := NewSSMLTextBuilder(WithElementBudget(2)).
+		AppendSentence("one").
+		AppendBreakStrength(BreakWeak)
+	if err := builder.Err(); err != nil {
+		t.Fatalf("at the budget: error = %v", err)
+	}
+
+	if builder.AppendPlainSpeech("plain text is free").Err() != nil {
+		t.Errorf("text without elements at the budget: error = %v", builder.Err())
+	}
+
+	if builder.AppendSentence("three").Err() == nil {
+		t.Errorf("over the budget = %s, want an error", builder.Build())
+	}
+
+	nested := NewSSMLTextBuilder(WithElementBudget(3)).
+		AppendSentence("one").
+		AppendEmphasisContent(EmphasisStrong, func(inner *SSMLTextBuilder) {
+			inner.AppendNumber(2)
+		})
+	if err := nested.Err(); err != nil {
+		t.Fatalf("nested content at the budget: error = %v", err)
+	}
+
+	if got, want := nested.Counts(), 3; len(got) != want {
+		t.Errorf("Counts() = %v, want %d kinds of element", got, want)
+	}
+
+	if nested.AppendBreakStrength(BreakWeak).Err() == nil {
+		t.Errorf("over the budget after nested content = %s, want an error", nested.Build())
+	}
+
+	inner := NewSSMLTextBuilder(WithElementBudget(2)).
+		AppendSentence("one").
+		AppendEmphasisContent(EmphasisStrong, func(inner *SSMLTextBuilder) {
+			inner.AppendNumber(2)
+		})
+	if inner.Err() == nil {
+		t.Errorf("nested content over the budget = %s, want an error", inner.Build())
+	}
+}
+
+func TestDateHelpers(t *testing.T) {
+	date := time.Date(2024, time.November, 3, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		append func(*SSMLTextBuilder, time.Time) *SSMLTextBuilder
+		want   string
+	}{
+		{"AppendMonthDayYear", (*SSMLTextBuilder).AppendMonthDayYear, `<say-as interpret-as="date" format="mdy">11-03-2024</say-as>`},
+		{"AppendDayMonthYear", (*SSMLTextBuilder).AppendDayMonthYear, `<say-as interpret-as="date" format="dmy">03-11-2024</say-as>`},
+		{"AppendYearMonthDay", (*SSMLTextBuilder).AppendYearMonthDay, `<say-as interpret-as="date" format="ymd">2024-11-03</say-as>`},
+		{"AppendMonthDay", (*SSMLTextBuilder).AppendMonthDay, `<say-as interpret-as="date" format="md">11-03</say-as>`},
+		{"AppendDayMonth", (*SSMLTextBuilder).AppendDayMonth, `<say-as interpret-as="date" format="dm">03-11</say-as>`},
+		{"AppendYearMonth", (*SSMLTextBuilder).AppendYearMonth, `<say-as interpret-as="date" format="ym">2024-11</say-as>`},
+		{"AppendMonthYear", (*SSMLTextBuilder).AppendMonthYear, `<say-as interpret-as="date" format="my">11-2024</say-as>`},
+		{"AppendDayOnly", (*SSMLTextBuilder).AppendDayOnly, `<say-as interpret-as="date" format="d">03</say-as>`},
+		{"AppendMonthOnly", (*SSMLTextBuilder).AppendMonthOnly, `<say-as interpret-as="date" format="m">11</say-as>`},
+		{"AppendYearOnly", (*SSMLTextBuilder).AppendYearOnly, `<say-as interpret-as="date" format="y">2024</say-as>`},
+	}
+
+	for _, test := range tests {
+		builder := test.append(NewSSMLTextBuilder(), date)
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("%s = %s, want %s", test.name, got, test.want)
+		}
+
+		if err := builder.Err(); err != nil {
+			t.Errorf("%s error = %v", test.name, err)
+		}
+	}
+}
+
+func TestAppendPlainSpeechRaw(t *testing.T) {
+	builder := NewSSMLTextBuilder().
+		AppendPlainSpeech("Tom & Jerry, ").
+		AppendPlainSpeechRaw("Tom &amp; Jerry, ").
+		AppendPlainSpeech("<3")
+
+	if got, want := builder.Inner(), "Tom &amp; Jerry, Tom &amp; Jerry, &lt;3"; got != want {
+		t.Errorf("mixed escaped and raw appends = %s, want %s", got, want)
+	}
+
+	if err := builder.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestAppendCharacters(t *testing.T) {
+	tests := []struct {
+		locale  string
+		want    string
+		wantErr bool
+	}{
+		{"", `<say-as interpret-as="characters">été</say-as>`, false},
+		{"fr-FR", `<lang xml:lang="fr-FR"><say-as interpret-as="characters">été</say-as></lang>`, false},
+		{"xx-XX", "", true},
+	}
+
+	for _, test := range tests {
+		builder := NewSSMLTextBuilder().AppendCharacters("été", test.locale)
+
+		if got := builder.Inner(); got != test.want {
+			t.Errorf("AppendCharacters(%q) = %s, want %s", test.locale, got, test.want)
+		}
+
+		if err := builder.Err(); (err != nil) != test.wantErr {
+			t.Errorf("AppendCharacters(%q) error = %v, want error %v", test.locale, err, test.wantErr)
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendPlainSpeech("Hello ").AppendEmphasis("there", EmphasisStrong)
+
+	ssml := Output{Builder: builder, Mode: OutputSSML}
+	if got, want := ssml.String(), `<speak>Hello <emphasis level="strong">there</emphasis></speak>`; got != want {
+		t.Errorf("SSML String() = %s, want %s", got, want)
+	}
+
+	payload, err := ssml.Payload()
+	if err != nil || payload.Type != "SSML" || payload.SSML != ssml.String() || payload.Text != "" {
+		t.Errorf("SSML Payload() = %+v, %v", payload, err)
+	}
+
+	plain := Output{Builder: builder, Mode: OutputPlainText}
+	if got, want := plain.String(), "Hello there"; got != want {
+		t.Errorf("plain text String() = %s, want %s", got, want)
+	}
+
+	payload, err = plain.Payload()
+	if err != nil || payload.Type != "PlainText" || payload.Text != "Hello there" || payload.SSML != "" {
+		t.Errorf("plain text Payload() = %+v, %v", payload, err)
+	}
+
+	failed := Output{Builder: NewSSMLTextBuilder().AppendBreakTime(-time.Second)}
+	if _, err := failed.Payload(); err == nil {
+		t.Error("Payload() of a failed builder: error = nil")
+	}
+}
+
+func TestAppendDomainContent(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendDomainContent(DomainNews, func(inner *SSMLTextBuilder) {
+		inner.AppendPlainSpeech("Breaking news.").
+			AppendBreakTime(time.Second).
+			AppendEmphasis("Markets rally", EmphasisModerate)
+	})
+
+	want := `<amazon:domain name="news">Breaking news.<break time="1000ms"/><emphasis level="moderate">Markets rally</emphasis></amazon:domain>`
+	if got := builder.Inner(); got != want {
+		t.Errorf("AppendDomainContent = %s, want %s", got, want)
+	}
+
+	if err := builder.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestAppendParagraphs(t *testing.T) {
+	got := NewSSMLTextBuilder().AppendParagraphs([]string{"One.", "Tom & Jerry.", "Three."}).Inner()
+
+	if want := `<p>One.</p><p>Tom &amp; Jerry.</p><p>Three.</p>`; got != want {
+		t.Errorf("AppendParagraphs = %s, want %s", got, want)
+	}
+}
+
+func TestAppendNumberSpoken(t *testing.T) {
+	if got, want := NewSSMLTextBuilder().AppendNumberSpoken("007", true).Inner(), `<say-as interpret-as="digits">007</say-as>`; got != want {
+		t.Errorf("AppendNumberSpoken(007, true) = %s, want %s", got, want)
+	}
+
+	if got, want := NewSSMLTextBuilder().AppendNumberSpoken("007", false).Inner(), `<say-as interpret-as="cardinal">007</say-as>`; got != want {
+		t.Errorf("AppendNumberSpoken(007, false) = %s, want %s", got, want)
+	}
+}
+
+func TestMarshalText(t *testing.T) {
+	builder := NewSSMLTextBuilder().AppendPlainSpeech("Hi")
+
+	got, err := builder.MarshalText()
+	if err != nil || string(got) != builder.Build() {
+		t.Errorf("MarshalText() = %s, %v, want %s", got, err, builder.Build())
+	}
+
+	if _, err := NewSSMLTextBuilder().AppendBreakTime(-time.Second).MarshalText(); err == nil {
+		t.Error("MarshalText() of a failed builder: error = nil")
+	}
+}